@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The -checksum of a set of rows is the sum, modulo 2^64, of the first 60
+// bits of the MD5 of each row's text: its columns as Postgres prints them,
+// NULL as \N, joined by the unit separator. Client-generated UUID keys are
+// drawn at random each time the rows are streamed, so the id column is
+// left out. Being a sum, it doesn't depend on the order the rows were
+// written or are read in, so concurrent workers need no ordering and the
+// server needs no sort.
+
+// checksumRows returns the checksum of the n rows of src from offset,
+// written to columns.
+func checksumRows(src rowSource, offset, n int, columns []string) (uint64, error) {
+	var sum uint64
+	var b strings.Builder
+	values := make([]any, 0, len(columns))
+	rows := src.Stream(offset, n)
+	defer rows.Close()
+	for row, ok := rows.Next(); ok; row, ok = rows.Next() {
+		values = row.values(values[:0])
+		b.Reset()
+		first := true
+		for i, v := range values {
+			if columns[i] == "id" {
+				continue
+			}
+			if !first {
+				b.WriteByte(0x1f)
+			}
+			first = false
+			text, err := checksumText(columns[i], v)
+			if err != nil {
+				return 0, err
+			}
+			b.WriteString(text)
+		}
+		digest := md5.Sum([]byte(b.String()))
+		sum += binary.BigEndian.Uint64(digest[:8]) >> 4
+	}
+	return sum, rows.Err()
+}
+
+// checksumText renders a value of column the way the server's checksum
+// query prints it.
+func checksumText(column string, v any) (string, error) {
+	switch v := v.(type) {
+	case *string:
+		if v == nil {
+			return `\N`, nil
+		}
+		return *v, nil
+	case string:
+		if column == "payload" {
+			return jsonbText(v)
+		}
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case pgtype.UUID:
+		h := hex.EncodeToString(v.Bytes[:])
+		return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+	case []int32:
+		b := []byte{'{'}
+		for i, n := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = strconv.AppendInt(b, int64(n), 10)
+		}
+		return string(append(b, '}')), nil
+	case []byte:
+		return hex.EncodeToString(v), nil
+	default:
+		return "", fmt.Errorf("no checksum text for %T in column %s", v, column)
+	}
+}
+
+// jsonbText returns a flat JSON object as jsonb prints it: keys ordered by
+// length and then bytewise, with a space after each colon and comma.
+func jsonbText(doc string) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(doc), &fields); err != nil {
+		return "", fmt.Errorf("invalid payload: %w", err)
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+	})
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteString(": ")
+		b.Write(fields[k])
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+// tableChecksum computes the checksum of every row of table on the server.
+func tableChecksum(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, columns []string) (uint64, error) {
+	var exprs []string
+	for _, c := range columns {
+		col := pgx.Identifier{c}.Sanitize()
+		switch c {
+		case "id":
+		case "blob":
+			// The text form of bytea depends on bytea_output
+			exprs = append(exprs, "coalesce(encode("+col+", 'hex'), '\\N')")
+		default:
+			exprs = append(exprs, "coalesce("+col+"::text, '\\N')")
+		}
+	}
+	sql := "SELECT (coalesce(sum(('x' || substr(md5(concat_ws(chr(31), " + strings.Join(exprs, ", ") +
+		")), 1, 15))::bit(60)::bigint), 0) % 18446744073709551616)::text FROM " + table.Sanitize()
+	var text string
+	if err := pool.QueryRow(ctx, sql).Scan(&text); err != nil {
+		return 0, fmt.Errorf("failed to checksum table: %w", err)
+	}
+	return strconv.ParseUint(text, 10, 64)
+}
+
+// validateChecksum checks that table holds exactly the rows with the given
+// checksum.
+func validateChecksum(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, columns []string, want uint64) error {
+	got, err := tableChecksum(ctx, pool, table, columns)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("checksum mismatch: %s has checksum %016x, expected %016x from the generated rows", table.Sanitize(), got, want)
+	}
+	return nil
+}
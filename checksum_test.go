@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestChecksumRows(t *testing.T) {
+	columns := tableColumns(false, false, false, false, 0, 0)
+	rows := []TestRow{
+		{data: "a", description: "first", counter1: 1, counter2: 10},
+		{data: "b", description: "second", counter1: 2, counter2: 20},
+		{data: "c", description: "third", counter1: 3, counter2: 30},
+		{data: "d", nullDesc: true, counter1: 4, counter2: 40},
+	}
+	checksum := func(rows []TestRow) uint64 {
+		t.Helper()
+		src := generatedRows{n: len(rows), gen: func(i int) TestRow { return rows[i] }}
+		sum, err := checksumRows(src, 0, len(rows), columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+	want := checksum(rows)
+
+	reversed := []TestRow{rows[3], rows[2], rows[1], rows[0]}
+	if got := checksum(reversed); got != want {
+		t.Errorf("checksum of the reversed rows = %x, want %x", got, want)
+	}
+
+	changed := append([]TestRow(nil), rows...)
+	changed[2].counter2++
+	if got := checksum(changed); got == want {
+		t.Errorf("checksum ignored a change to one counter")
+	}
+	nulled := append([]TestRow(nil), rows...)
+	nulled[0].nullDesc = true
+	if got := checksum(nulled); got == want {
+		t.Errorf("checksum ignored a description set to NULL")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// saveBaseline writes results to path as JSON, for a later -compare.
+func saveBaseline(path string, info runInfo, results []Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(f, info, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadBaseline reads results saved with -save, or written with
+// -format=json. Files from before the metadata block was added hold a bare
+// array of results and are accepted too.
+func loadBaseline(path string) ([]jsonResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var baseline []jsonResult
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			return nil, fmt.Errorf("failed to parse baseline %s: %w", path, err)
+		}
+		return baseline, nil
+	}
+	var out jsonOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline %s: %w", path, err)
+	}
+	return out.Results, nil
+}
+
+// comparison pairs a result with the baseline result for the same
+// parameters.
+type comparison struct {
+	label     string
+	old, cur  jsonResult
+	delta     float64 // Percent change in rows/sec
+	regressed bool
+}
+
+// compareResults matches results against baseline by operation, method,
+// batch size, transaction size, workers, table type, exec mode, pipeline
+// depth, index setup, commit mode, savepoints, foreign keys, trigger,
+// partitions, RETURNING and server. Baselines saved before some of these
+// were recorded take their defaults: table type logged, exec mode
+// cache_statement and trigger none. A result regressed when its throughput
+// dropped by more than threshold percent and its confidence interval
+// doesn't overlap the baseline's, so that noise isn't flagged.
+func compareResults(baseline []jsonResult, results []Result, threshold float64) []comparison {
+	var out []comparison
+	for _, r := range results {
+		cur := toJSONResult(r)
+		for _, old := range baseline {
+			if old.Op != cur.Op || old.Method != cur.Method || old.BatchSize != cur.BatchSize ||
+				old.TxSize != cur.TxSize || old.Workers != cur.Workers || cmp.Or(old.TableType, tableLogged) != cur.TableType ||
+				cmp.Or(old.ExecMode, execCacheStatement) != cur.ExecMode || old.PipelineDepth != cur.PipelineDepth ||
+				old.SecondaryIndexes != cur.SecondaryIndexes || old.IndexesRebuilt != cur.IndexesRebuilt ||
+				old.AsyncCommit != cur.AsyncCommit || old.SavepointEvery != cur.SavepointEvery ||
+				old.ForeignKeys != cur.ForeignKeys || old.ForeignKeysEnforced != cur.ForeignKeysEnforced ||
+				cmp.Or(old.Trigger, triggerNone) != cur.Trigger || old.Partitions != cur.Partitions ||
+				old.Returning != cur.Returning ||
+				old.Server != cur.Server {
+				continue
+			}
+			c := comparison{label: resultLabel(r), old: old, cur: cur}
+			if r.server != "" {
+				c.label = r.server + " " + c.label
+			}
+			if old.RowsPerSec > 0 {
+				c.delta = (cur.RowsPerSec - old.RowsPerSec) / old.RowsPerSec * 100
+			}
+			overlap := cur.RowsPerSec+cur.CI95 >= old.RowsPerSec-old.CI95
+			c.regressed = c.delta < -threshold && !overlap
+			out = append(out, c)
+			break
+		}
+	}
+	return out
+}
+
+// displayComparison prints one line per compared result.
+func displayComparison(w io.Writer, path string, comparisons []comparison) {
+	fmt.Fprintf(w, "=== Comparison with %s ===\n", path)
+	fmt.Fprintln(w)
+	if len(comparisons) == 0 {
+		fmt.Fprintln(w, "No results match the baseline")
+		fmt.Fprintln(w)
+		return
+	}
+	for _, c := range comparisons {
+		note := ""
+		if c.regressed {
+			note = "  REGRESSION"
+		}
+		fmt.Fprintf(w, "%-11s | %10.0f ±%-7.0f -> %10.0f ±%-7.0f rows/sec | %+6.1f%%%s\n",
+			c.label, c.old.RowsPerSec, c.old.CI95, c.cur.RowsPerSec, c.cur.CI95, c.delta, note)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,1008 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultTotalRows  = 10_000_000
+	defaultSampleSize = 100_000 // Number of rows per sample
+)
+
+var defaultBatchSizes = []int{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000}
+
+// config holds the benchmark parameters resolved from the command line.
+type config struct {
+	driver              string
+	dsns                []string
+	table               string
+	tableType           string
+	secondaryIndexes    int
+	rebuildIndexes      bool
+	foreignKeys         int
+	enforceForeignKeys  bool // Set per run under -foreign-keys, see benchmarkRuns
+	trigger             string
+	returning           bool
+	partitions          int
+	partitionBy         string
+	pk                  string
+	batchSizes          []int
+	batchRange          string
+	totalRows           int
+	sampleSize          int
+	duration            time.Duration
+	sampleTimeout       time.Duration
+	targetRate          float64
+	minSamples          int
+	maxSamples          int
+	samples             int
+	bootstrap           int
+	targetCV            float64
+	rejectOutliers      bool
+	txSize              int
+	isolation           string
+	maxRetries          int
+	workers             int
+	workerCounts        []int
+	maxConns            int
+	minConns            int
+	warmup              int
+	warmupRows          int
+	warmupMethod        string
+	overhead            int
+	format              string
+	label               string
+	output              string
+	stream              bool
+	save                string
+	compare             string
+	regressionThreshold float64
+	quiet               bool
+	dryRun              bool
+	printConfig         bool
+	logFormat           string
+	logLevel            string
+	metricsAddr         string
+	cpuProfile          string
+	memProfile          string
+	profileAllocs       bool
+	serverTiming        bool
+	crossover           bool // Set by -method=compare
+	method              string
+	methods             []string
+	conflictRate        float64
+	op                  string
+	mix                 string
+	mixRatio            mixRatio
+	prepopulateRows     int
+	seedRows            int
+	noTruncate          bool
+	cooldown            time.Duration
+	vacuumBetween       bool
+	validateRows        bool
+	checksum            bool
+	explain             bool
+	pgStats             bool
+	pgStatements        bool // Set per server under -pg-stats when pg_stat_statements can be read
+	skipMigrations      bool
+	autoCreate          bool
+	cleanup             cleanupMode
+	statementCache      bool
+	execMode            string
+	requireTLS          bool
+	pipelineDepth       int
+	shuffle             bool
+	asyncCommit         bool
+	savepointEvery      int
+	interleave          bool
+	randomData          bool
+	compressibility     int
+	csvInput            string
+	csvLoop             bool
+	nullRate            float64
+	rowSize             int
+	columns             int
+	payloadKeys         int
+	arrayLen            int
+	blobSize            int
+	seed                uint64
+}
+
+// stringList is a flag.Value parsing a comma-separated list of strings.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	var values []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	*l = values
+	return nil
+}
+
+// Values of -cleanup.
+const (
+	cleanupNone     = ""
+	cleanupTruncate = "truncate"
+	cleanupDrop     = "drop"
+)
+
+// cleanupMode is a flag.Value for -cleanup, which given without a value
+// truncates.
+type cleanupMode string
+
+func (m *cleanupMode) String() string {
+	if m == nil {
+		return ""
+	}
+	return string(*m)
+}
+
+func (m *cleanupMode) Set(s string) error {
+	switch s {
+	case "true", cleanupTruncate:
+		*m = cleanupTruncate
+	case "false":
+		*m = cleanupNone
+	case cleanupDrop:
+		*m = cleanupDrop
+	default:
+		return fmt.Errorf("expected %s or %s", cleanupTruncate, cleanupDrop)
+	}
+	return nil
+}
+
+func (m *cleanupMode) IsBoolFlag() bool { return true }
+
+// dsnList is a flag.Value collecting every occurrence of -dsn. Unlike
+// stringList it doesn't split on commas, which multi-host URLs contain.
+type dsnList []string
+
+func (l *dsnList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, " ")
+}
+
+func (l *dsnList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// intList is a flag.Value parsing a comma-separated list of integers.
+type intList []int
+
+func (l *intList) String() string {
+	if l == nil {
+		return ""
+	}
+	parts := make([]string, len(*l))
+	for i, v := range *l {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *intList) Set(s string) error {
+	var values []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", part)
+		}
+		values = append(values, v)
+	}
+	*l = values
+	return nil
+}
+
+// maxRangeSizes bounds the batch sizes -batch-range may generate, so that
+// a small step over a wide range is caught rather than run.
+const maxRangeSizes = 100
+
+// parseBatchRange expands a -batch-range spec. "min:max:factor" gives the
+// geometric sequence min, min*factor, ... and "min:max:+step" the
+// arithmetic one min, min+step, ..., both stopping at max.
+func parseBatchRange(spec string) ([]int, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid -batch-range %q: expected min:max:factor or min:max:+step", spec)
+	}
+	lo, err := strconv.Atoi(parts[0])
+	if err != nil || lo <= 0 {
+		return nil, fmt.Errorf("invalid -batch-range %q: min must be a positive integer", spec)
+	}
+	hi, err := strconv.Atoi(parts[1])
+	if err != nil || hi < lo {
+		return nil, fmt.Errorf("invalid -batch-range %q: max must be an integer no smaller than min", spec)
+	}
+
+	var next func(v float64) float64
+	if step, ok := strings.CutPrefix(parts[2], "+"); ok {
+		n, err := strconv.Atoi(step)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid -batch-range %q: step must be a positive integer", spec)
+		}
+		next = func(v float64) float64 { return v + float64(n) }
+	} else {
+		factor, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || !(factor > 1) {
+			return nil, fmt.Errorf("invalid -batch-range %q: factor must be a number greater than 1", spec)
+		}
+		next = func(v float64) float64 { return v * factor }
+	}
+
+	var sizes []int
+	for v := float64(lo); v <= float64(hi); v = next(v) {
+		size := int(math.Round(v))
+		if len(sizes) > 0 && size == sizes[len(sizes)-1] {
+			return nil, fmt.Errorf("invalid -batch-range %q: factor is too small to give distinct batch sizes from %d", spec, size)
+		}
+		if len(sizes) == maxRangeSizes {
+			return nil, fmt.Errorf("invalid -batch-range %q: generates more than %d batch sizes", spec, maxRangeSizes)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// parseFlags parses the flags of the run command from args. They are
+// parsed into a fresh flag.CommandLine that returns its errors, so that
+// invalid flags exit with exitError rather than flag's status 2, which
+// would read as exitRegression.
+func parseFlags(args []string) (config, error) {
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	cfg := config{
+		batchSizes:          append([]int(nil), defaultBatchSizes...),
+		totalRows:           defaultTotalRows,
+		sampleSize:          defaultSampleSize,
+		driver:              driverPostgres,
+		table:               "test_data",
+		tableType:           tableLogged,
+		pk:                  pkSerial,
+		format:              formatText,
+		method:              methodBatch,
+		op:                  opInsert,
+		prepopulateRows:     defaultSampleSize,
+		workers:             1,
+		warmup:              2,
+		minSamples:          5,
+		maxSamples:          20,
+		targetCV:            0.05,
+		isolation:           "read-committed",
+		logFormat:           logFormatText,
+		regressionThreshold: 5,
+		logLevel:            "info",
+		statementCache:      true,
+		execMode:            execCacheStatement,
+		trigger:             triggerNone,
+		partitionBy:         partitionHash,
+		rowSize:             100,
+		seed:                1,
+	}
+
+	flag.StringVar(&cfg.driver, "driver", cfg.driver, "database backend: postgres (mysql is not supported yet)")
+	flag.Var((*dsnList)(&cfg.dsns), "dsn", "database connection string (overrides DATABASE_URL); repeat to compare servers")
+	flag.StringVar(&cfg.table, "table", cfg.table, "table to insert into; may be schema-qualified")
+	flag.IntVar(&cfg.secondaryIndexes, "secondary-indexes", 0, "number of secondary indexes to create on the table")
+	flag.BoolVar(&cfg.rebuildIndexes, "rebuild-indexes", false, "also measure dropping the secondary indexes during the load and rebuilding them after it")
+	flag.StringVar(&cfg.tableType, "table-type", cfg.tableType, "kind of table to insert into: logged, unlogged or temp")
+	flag.StringVar(&cfg.pk, "pk", cfg.pk, "primary key: serial, or client-generated uuid (random v4) or uuidv7 (time-ordered)")
+	flag.Var((*intList)(&cfg.batchSizes), "batch-sizes", "comma-separated list of batch sizes to test")
+	flag.StringVar(&cfg.batchRange, "batch-range", "", "generate the batch sizes as min:max:factor, multiplying by factor, or min:max:+step, adding step")
+	flag.IntVar(&cfg.totalRows, "total-rows", cfg.totalRows, "number of rows to generate")
+	flag.IntVar(&cfg.txSize, "tx-size", 0, "rows per transaction (0 uses the batch size)")
+	flag.StringVar(&cfg.isolation, "isolation", cfg.isolation, "transaction isolation level: read-committed, repeatable-read or serializable")
+	flag.IntVar(&cfg.maxRetries, "max-retries", 0, "times a transaction failing with a transient error is retried (default 10 under repeatable-read and serializable, else 0)")
+	flag.IntVar(&cfg.workers, "workers", cfg.workers, "number of concurrent insert workers")
+	flag.Var((*intList)(&cfg.workerCounts), "worker-counts", "comma-separated worker counts to test with every batch size (overrides -workers)")
+	flag.IntVar(&cfg.maxConns, "max-conns", 0, "maximum pool connections (0 keeps the pgx default or the DSN's pool_max_conns)")
+	flag.IntVar(&cfg.minConns, "min-conns", 0, "connections the pool keeps open (0 keeps the pgx default or the DSN's pool_min_conns)")
+	flag.IntVar(&cfg.warmup, "warmup", cfg.warmup, "number of warmup transactions per batch size (0 disables warmup)")
+	flag.IntVar(&cfg.warmupRows, "warmup-rows", 0, "rows per warmup transaction (0 uses the batch size)")
+	flag.StringVar(&cfg.warmupMethod, "warmup-method", "", "insert method of the warmup transactions (default: the measured method)")
+	flag.BoolVar(&cfg.skipMigrations, "skip-migrations", false, "don't run migrations; only check that the table exists")
+	flag.Var(&cfg.cleanup, "cleanup", "after the run, even a failed one, empty the table, or with -cleanup=drop drop it")
+	flag.BoolVar(&cfg.autoCreate, "auto-create", false, "create the table if it doesn't exist instead of running migrations; implies -skip-migrations")
+	flag.IntVar(&cfg.overhead, "overhead", 0, "first time connecting, acquiring a pooled connection and an empty transaction this many times each (0 skips)")
+	flag.BoolVar(&cfg.validateRows, "validate", false, "check the table's row count after every sample")
+	flag.DurationVar(&cfg.cooldown, "cooldown", 0, "pause between samples to let the server quiesce")
+	flag.BoolVar(&cfg.vacuumBetween, "vacuum-between", false, "VACUUM the table between samples, during the cooldown")
+	flag.BoolVar(&cfg.checksum, "checksum", false, "after each sample, compare a checksum of the table's contents with one of the rows generated")
+	flag.BoolVar(&cfg.pgStats, "pg-stats", false, "report the server's block hits, reads and I/O time per sample from pg_stat_database and pg_stat_statements")
+	flag.BoolVar(&cfg.explain, "explain", false, "run EXPLAIN (ANALYZE, BUFFERS) on one batch after each sample and report the server's timings")
+	flag.BoolVar(&cfg.noTruncate, "no-truncate", false, "let the table grow across samples instead of truncating before each one")
+	flag.Float64Var(&cfg.nullRate, "null-rate", 0, "fraction of rows whose description is NULL")
+	flag.BoolVar(&cfg.randomData, "random-data", false, "generate pseudo-random row payloads instead of repetitive text")
+	flag.IntVar(&cfg.compressibility, "compressibility", 0, "percent of each -random-data payload made of repeated bytes that compress well, the rest random (0-100); implies -random-data")
+	flag.IntVar(&cfg.rowSize, "row-size", cfg.rowSize, "payload length in bytes for -random-data")
+	flag.IntVar(&cfg.foreignKeys, "foreign-keys", 0, "add this many columns referencing a parent table, and measure each benchmark with and without their foreign keys")
+	flag.StringVar(&cfg.trigger, "trigger", cfg.trigger, "also measure each benchmark with a BEFORE INSERT trigger on every row: none, noop or timestamp (sets updated_at)")
+	flag.IntVar(&cfg.partitions, "partitions", 0, "also measure each benchmark on a copy of the table partitioned on id into this many partitions")
+	flag.StringVar(&cfg.partitionBy, "partition-by", cfg.partitionBy, "how -partitions splits the table: hash or range")
+	flag.BoolVar(&cfg.returning, "returning", false, "also measure each benchmark with RETURNING id on the inserts, reading back the ids; requires -method=batch, prepared or values")
+	flag.IntVar(&cfg.columns, "columns", 0, "extra text columns (extra_1 to extra_N) to write in each row")
+	flag.IntVar(&cfg.blobSize, "blob-size", 0, "write this many random bytes to the bytea blob column (0 leaves it out)")
+	flag.IntVar(&cfg.arrayLen, "array-len", 0, "write an integer array of this length to the numbers column (0 leaves it out)")
+	flag.IntVar(&cfg.payloadKeys, "payload-keys", 0, "write a JSON object with this many fields to the jsonb payload column (0 leaves it out)")
+	flag.StringVar(&cfg.csvInput, "csv-input", "", "read the rows from this CSV file, whose header names some of data, description, counter1 and counter2")
+	flag.BoolVar(&cfg.csvLoop, "csv-loop", false, "start over from the first row of -csv-input when it has fewer than -total-rows")
+	flag.Uint64Var(&cfg.seed, "seed", cfg.seed, "random seed for -random-data and -blob-size")
+	flag.IntVar(&cfg.sampleSize, "sample-size", cfg.sampleSize, "number of rows inserted per sample")
+	flag.BoolVar(&cfg.dryRun, "dry-run", false, "print the plan and exit without connecting to the database")
+	flag.BoolVar(&cfg.printConfig, "print-config", false, "print the resolved configuration and exit without connecting to the database")
+	flag.StringVar(&cfg.format, "format", cfg.format, "output format: text, json, benchmark, csv, markdown or html")
+	flag.StringVar(&cfg.label, "label", "", "label recorded with the results, to tell archived runs apart")
+	flag.StringVar(&cfg.save, "save", "", "save results as JSON to this file for a later -compare")
+	flag.StringVar(&cfg.compare, "compare", "", "compare results with a baseline saved with -save and fail on regressions")
+	flag.Float64Var(&cfg.regressionThreshold, "regression-threshold", cfg.regressionThreshold, "percent drop in rows/sec that -compare counts as a regression")
+	flag.BoolVar(&cfg.quiet, "quiet", false, "suppress progress messages and print only the results")
+	flag.StringVar(&cfg.logFormat, "log-format", cfg.logFormat, "diagnostic log format on stderr: text or json")
+	flag.StringVar(&cfg.logLevel, "log-level", cfg.logLevel, "diagnostic log level: debug, info, warn or error (warn under -quiet)")
+	flag.BoolVar(&cfg.stream, "stream", false, "write a JSON line to stdout as each sample and each result completes")
+	flag.StringVar(&cfg.output, "output", "", "write results to this file instead of stdout (csv appends)")
+	flag.StringVar(&cfg.cpuProfile, "cpuprofile", "", "write a CPU profile of the measurements to this file")
+	flag.StringVar(&cfg.memProfile, "memprofile", "", "write a heap profile to this file after the measurements")
+	flag.BoolVar(&cfg.serverTiming, "server-timing", false, "read each transaction's time by the server's clock before committing, and report the rest as network and client overhead")
+	flag.BoolVar(&cfg.profileAllocs, "profile-allocs", false, "report the client's heap allocations and GCs per row while inserting")
+	flag.StringVar(&cfg.metricsAddr, "metrics-addr", "", "serve Prometheus metrics on this address while running (e.g. :9090)")
+	flag.Var((*stringList)(&cfg.methods), "method", "comma-separated insert methods: batch, copy-binary (or copy), copy-text, copy-stream, values, prepared or upsert, or compare for batch and copy side by side")
+	flag.Float64Var(&cfg.conflictRate, "conflict-rate", cfg.conflictRate, "fraction of rows that already exist when inserting with -method=upsert")
+	flag.StringVar(&cfg.op, "op", cfg.op, "operation to benchmark: insert, update, delete or mix")
+	flag.StringVar(&cfg.mix, "mix", "", "blend of statements for -op=mix, e.g. insert:70,update:20,delete:10 (implies -op=mix)")
+	flag.IntVar(&cfg.prepopulateRows, "prepopulate-rows", cfg.prepopulateRows, "rows loaded before measuring update or delete")
+	flag.IntVar(&cfg.seedRows, "seed-rows", 0, "rows loaded into the table before each sample, outside the measurement")
+	flag.BoolVar(&cfg.statementCache, "statement-cache", cfg.statementCache, "let pgx cache prepared statements automatically")
+	flag.BoolVar(&cfg.asyncCommit, "async-commit", false, "also run each benchmark with synchronous_commit=off for its transactions, to show what waiting for the WAL flush costs")
+	flag.IntVar(&cfg.savepointEvery, "savepoint-every", 0, "also run each benchmark with every this many rows wrapped in a SAVEPOINT and RELEASE SAVEPOINT, as ORMs with nested transactions do (0 = off); requires -method=batch or prepared")
+	flag.BoolVar(&cfg.shuffle, "shuffle", false, "run the batch sizes, methods and worker counts in a random order, seeded by -seed")
+	flag.BoolVar(&cfg.interleave, "interleave", false, "take turns running one sample of each batch size, method and worker count")
+	flag.IntVar(&cfg.pipelineDepth, "pipeline-depth", 0, "statements sent per pipelined round-trip by -method=batch and prepared (0 = the whole batch)")
+	flag.BoolVar(&cfg.requireTLS, "require-tls", false, "fail unless the connection to the server is encrypted with TLS")
+	flag.StringVar(&cfg.execMode, "exec-mode", cfg.execMode, "pgx query exec mode: cache_statement, cache_describe, describe_exec, exec or simple_protocol")
+	flag.DurationVar(&cfg.sampleTimeout, "sample-timeout", 0, "abort a sample that takes longer than this, rolling back and retrying it (0 = no limit)")
+	flag.IntVar(&cfg.minSamples, "min-samples", cfg.minSamples, "minimum number of samples before checking stability")
+	flag.IntVar(&cfg.samples, "samples", 0, "take exactly this many samples per batch size without checking stability, overriding -min-samples, -max-samples and -target-cv (0 = adaptive)")
+	flag.IntVar(&cfg.bootstrap, "bootstrap", 0, "also report a percentile bootstrap 95% confidence interval from this many resamples, seeded by -seed (0 = off)")
+	flag.IntVar(&cfg.maxSamples, "max-samples", cfg.maxSamples, "maximum number of samples per batch size")
+	flag.Float64Var(&cfg.targetCV, "target-cv", cfg.targetCV, "coefficient of variation at which a batch size is considered stable")
+	flag.BoolVar(&cfg.rejectOutliers, "reject-outliers", false, "leave samples outside 1.5 IQR out of the mean and CV")
+	flag.Float64Var(&cfg.targetRate, "target-rate", 0, "start transactions on a fixed schedule at this many rows/sec (requires -duration)")
+	flag.DurationVar(&cfg.duration, "duration", 0, "run each batch size for this long instead of sampling until stable")
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	// Only the stricter levels abort transactions that conflict, so only
+	// they retry by default
+	if !flagSet("max-retries") && cfg.isolation != "read-committed" && !slices.Contains(cfg.methods, methodCopyStream) {
+		cfg.maxRetries = serializationRetries
+	}
+
+	if cfg.batchRange != "" {
+		if flagSet("batch-sizes") {
+			return config{}, errors.New("-batch-sizes and -batch-range are mutually exclusive")
+		}
+		sizes, err := parseBatchRange(cfg.batchRange)
+		if err != nil {
+			return config{}, err
+		}
+		cfg.batchSizes = sizes
+	}
+
+	if cfg.pk != pkSerial && !flagSet("table") {
+		cfg.table = uuidTable
+	}
+	if cfg.autoCreate {
+		cfg.skipMigrations = true
+	}
+	if flagSet("compressibility") {
+		cfg.randomData = true
+	}
+	if cfg.samples > 0 {
+		cfg.minSamples, cfg.maxSamples = cfg.samples, cfg.samples
+	}
+	if cfg.quiet && !flagSet("log-level") {
+		cfg.logLevel = "warn"
+	}
+	// -statement-cache=false predates -exec-mode and stands for describe_exec
+	if !cfg.statementCache {
+		if flagSet("exec-mode") {
+			return config{}, errors.New("-statement-cache=false and -exec-mode are mutually exclusive")
+		}
+		cfg.execMode = execDescribeExec
+	}
+
+	if len(cfg.methods) == 0 {
+		cfg.methods = []string{cfg.method}
+	}
+	if slices.Contains(cfg.methods, methodCompare) {
+		if len(cfg.methods) > 1 {
+			return config{}, fmt.Errorf("-method=%s measures %s and %s and can't be combined with other methods", methodCompare, methodBatch, methodCopy)
+		}
+		cfg.methods, cfg.crossover = []string{methodBatch, methodCopy}, true
+	}
+	cfg.method = cfg.methods[0]
+
+	if len(cfg.workerCounts) > 0 && flagSet("workers") {
+		return config{}, errors.New("-workers and -worker-counts are mutually exclusive")
+	}
+	if len(cfg.workerCounts) == 0 {
+		cfg.workerCounts = []int{cfg.workers}
+	}
+
+	if cfg.mix != "" {
+		if flagSet("op") && cfg.op != opMix {
+			return config{}, fmt.Errorf("-mix requires -op=%s", opMix)
+		}
+		ratio, err := parseMix(cfg.mix)
+		if err != nil {
+			return config{}, err
+		}
+		cfg.op, cfg.mixRatio = opMix, ratio
+	} else if cfg.op == opMix {
+		return config{}, fmt.Errorf("-op=%s requires -mix", opMix)
+	}
+
+	// Update and delete always load the table first, so for them -seed-rows
+	// only sets how much
+	if cfg.op != opInsert && flagSet("seed-rows") {
+		if flagSet("prepopulate-rows") {
+			return config{}, errors.New("-seed-rows and -prepopulate-rows are mutually exclusive")
+		}
+		cfg.prepopulateRows, cfg.seedRows = cfg.seedRows, 0
+	}
+
+	if cfg.duration > 0 && flagSet("sample-size") {
+		return config{}, errors.New("-duration and -sample-size are mutually exclusive")
+	}
+
+	if err := cfg.validate(); err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+func (cfg config) validate() error {
+	switch cfg.driver {
+	case driverPostgres:
+	case driverMySQL:
+		return errors.New("-driver=mysql is not supported yet")
+	default:
+		return fmt.Errorf("unknown -driver %q, expected postgres", cfg.driver)
+	}
+	if cfg.table == "" {
+		return errors.New("-table must not be empty")
+	}
+	if cfg.totalRows <= 0 {
+		return errors.New("-total-rows must be positive")
+	}
+	if cfg.sampleSize <= 0 {
+		return errors.New("-sample-size must be positive")
+	}
+	switch cfg.format {
+	case formatText, formatJSON, formatBenchmark, formatCSV, formatMarkdown, formatHTML:
+	default:
+		return fmt.Errorf("unknown -format %q", cfg.format)
+	}
+	if cfg.sampleTimeout < 0 {
+		return errors.New("-sample-timeout must not be negative")
+	}
+	if cfg.sampleTimeout > 0 {
+		// A retried sample starts over from a truncated table
+		switch {
+		case cfg.duration > 0:
+			return errors.New("-sample-timeout does not support -duration")
+		case cfg.noTruncate:
+			return errors.New("-sample-timeout does not support -no-truncate")
+		}
+	}
+	if cfg.bootstrap < 0 {
+		return errors.New("-bootstrap must not be negative")
+	}
+	if cfg.samples < 0 {
+		return errors.New("-samples must not be negative")
+	}
+	if cfg.samples > 0 {
+		switch {
+		case cfg.samples < 2:
+			return errors.New("-samples must be at least 2")
+		case cfg.duration > 0:
+			return errors.New("-samples does not support -duration")
+		}
+	}
+	if cfg.minSamples < 2 {
+		return errors.New("-min-samples must be at least 2")
+	}
+	if cfg.minSamples > cfg.maxSamples {
+		return fmt.Errorf("-min-samples (%d) must not exceed -max-samples (%d)", cfg.minSamples, cfg.maxSamples)
+	}
+	if cfg.targetCV <= 0 || cfg.targetCV >= 1 {
+		return errors.New("-target-cv must be between 0 and 1 exclusive")
+	}
+	if cfg.duration < 0 {
+		return errors.New("-duration must not be negative")
+	}
+	if cfg.cooldown < 0 {
+		return errors.New("-cooldown must not be negative")
+	}
+	if cfg.targetRate < 0 {
+		return errors.New("-target-rate must not be negative")
+	}
+	if cfg.targetRate > 0 && cfg.duration == 0 {
+		return errors.New("-target-rate requires -duration")
+	}
+	if cfg.crossover && cfg.op != opInsert {
+		return fmt.Errorf("-method=%s requires -op=%s", methodCompare, opInsert)
+	}
+	// Transactions on a schedule are timed from when they were due
+	if cfg.serverTiming && cfg.targetRate > 0 {
+		return errors.New("-server-timing does not support -target-rate")
+	}
+	if cfg.txSize < 0 {
+		return errors.New("-tx-size must not be negative")
+	}
+	if cfg.maxRetries < 0 {
+		return errors.New("-max-retries must not be negative")
+	}
+	if cfg.workers <= 0 {
+		return errors.New("-workers must be positive")
+	}
+	for _, w := range cfg.workerCounts {
+		if w <= 0 {
+			return fmt.Errorf("worker count %d must be positive", w)
+		}
+	}
+	if cfg.regressionThreshold < 0 {
+		return errors.New("-regression-threshold must not be negative")
+	}
+	if cfg.maxConns < 0 {
+		return errors.New("-max-conns must not be negative")
+	}
+	if cfg.minConns < 0 {
+		return errors.New("-min-conns must not be negative")
+	}
+	if cfg.maxConns > 0 && cfg.minConns > cfg.maxConns {
+		return fmt.Errorf("-min-conns (%d) must not exceed -max-conns (%d)", cfg.minConns, cfg.maxConns)
+	}
+	if cfg.columns < 0 {
+		return errors.New("-columns must not be negative")
+	}
+	// Postgres allows 1600 columns per table, and the migrations create ten
+	if cfg.columns > 1600-10 {
+		return fmt.Errorf("-columns must not exceed %d", 1600-10)
+	}
+	if cfg.foreignKeys < 0 {
+		return errors.New("-foreign-keys must not be negative")
+	}
+	if cfg.foreignKeys > 0 {
+		switch {
+		case cfg.op != opInsert:
+			return fmt.Errorf("-foreign-keys requires -op=%s", opInsert)
+		case cfg.skipMigrations:
+			return errors.New("-foreign-keys does not support -skip-migrations")
+		case cfg.interleave:
+			return errors.New("-foreign-keys does not support -interleave")
+		// A temp table can only reference another temp table
+		case cfg.tableType == tableTemp:
+			return fmt.Errorf("-foreign-keys does not support -table-type=%s", tableTemp)
+		}
+	}
+	if _, ok := triggerFunctions[cfg.trigger]; !ok && cfg.trigger != triggerNone {
+		return fmt.Errorf("unknown -trigger %q", cfg.trigger)
+	}
+	if cfg.trigger != triggerNone {
+		switch {
+		case cfg.op != opInsert:
+			return fmt.Errorf("-trigger requires -op=%s", opInsert)
+		case cfg.skipMigrations:
+			return errors.New("-trigger does not support -skip-migrations")
+		case cfg.interleave:
+			return errors.New("-trigger does not support -interleave")
+		}
+	}
+	if cfg.returning {
+		if cfg.op != opInsert {
+			return fmt.Errorf("-returning requires -op=%s", opInsert)
+		}
+		for _, m := range cfg.methods {
+			if m != methodBatch && m != methodPrepared && m != methodMultiValues {
+				return fmt.Errorf("-returning requires -method=%s, %s or %s", methodBatch, methodPrepared, methodMultiValues)
+			}
+		}
+	}
+	if cfg.partitions < 0 {
+		return errors.New("-partitions must not be negative")
+	}
+	if cfg.partitionBy != partitionHash && cfg.partitionBy != partitionRange {
+		return fmt.Errorf("unknown -partition-by %q", cfg.partitionBy)
+	}
+	if flagSet("partition-by") && cfg.partitions == 0 {
+		return errors.New("-partition-by requires -partitions")
+	}
+	if cfg.partitions > 0 {
+		// The partitioned copy is made once, from the table as set up for
+		// the whole run
+		switch {
+		case cfg.skipMigrations:
+			return errors.New("-partitions does not support -skip-migrations")
+		case cfg.tableType != tableLogged:
+			return fmt.Errorf("-partitions requires -table-type=%s", tableLogged)
+		case cfg.rebuildIndexes:
+			return errors.New("-partitions does not support -rebuild-indexes")
+		case cfg.foreignKeys > 0:
+			return errors.New("-partitions does not support -foreign-keys")
+		case cfg.trigger != triggerNone:
+			return errors.New("-partitions does not support -trigger")
+		}
+	}
+	if cfg.seedRows < 0 {
+		return errors.New("-seed-rows must not be negative")
+	}
+	if cfg.seedRows > cfg.totalRows {
+		return fmt.Errorf("-seed-rows (%d) must not exceed -total-rows (%d)", cfg.seedRows, cfg.totalRows)
+	}
+	if cfg.secondaryIndexes < 0 {
+		return errors.New("-secondary-indexes must not be negative")
+	}
+	if cfg.checksum {
+		// The expected contents are only known when every sample starts
+		// from an empty table and writes each of its rows once
+		switch {
+		case cfg.op != opInsert:
+			return fmt.Errorf("-checksum requires -op=%s", opInsert)
+		case cfg.duration > 0:
+			return errors.New("-checksum does not support -duration")
+		case cfg.noTruncate:
+			return errors.New("-checksum does not support -no-truncate")
+		case slices.Contains(cfg.methods, methodUpsert):
+			return fmt.Errorf("-checksum does not support -method=%s", methodUpsert)
+		}
+	}
+	if cfg.explain && cfg.op != opInsert {
+		return fmt.Errorf("-explain requires -op=%s", opInsert)
+	}
+	if cfg.rebuildIndexes {
+		if cfg.secondaryIndexes == 0 {
+			return errors.New("-rebuild-indexes requires -secondary-indexes")
+		}
+		if cfg.op != opInsert {
+			return fmt.Errorf("-rebuild-indexes requires -op=%s", opInsert)
+		}
+	}
+	if cfg.blobSize < 0 {
+		return errors.New("-blob-size must not be negative")
+	}
+	if cfg.arrayLen < 0 {
+		return errors.New("-array-len must not be negative")
+	}
+	if cfg.payloadKeys < 0 {
+		return errors.New("-payload-keys must not be negative")
+	}
+	if cfg.rowSize <= 0 {
+		return errors.New("-row-size must be positive")
+	}
+	if cfg.warmup < 0 {
+		return errors.New("-warmup must not be negative")
+	}
+	if cfg.overhead < 0 {
+		return errors.New("-overhead must not be negative")
+	}
+	// The migrations would consider a dropped table still created
+	if cfg.cleanup == cleanupDrop && !cfg.skipMigrations {
+		return errors.New("-cleanup=drop requires -skip-migrations or -auto-create")
+	}
+	if cfg.warmupRows < 0 {
+		return errors.New("-warmup-rows must not be negative")
+	}
+	if _, ok := insertMethods[cfg.warmupMethod]; cfg.warmupMethod != "" && !ok {
+		return fmt.Errorf("unknown -warmup-method %q", cfg.warmupMethod)
+	}
+	if _, ok := isolationLevels[cfg.isolation]; !ok {
+		return fmt.Errorf("unknown -isolation %q", cfg.isolation)
+	}
+	if cfg.interleave {
+		// Each sample must start from the same table, whichever ran before
+		switch {
+		case cfg.duration > 0:
+			return errors.New("-interleave does not support -duration")
+		case cfg.op != opInsert:
+			return fmt.Errorf("-interleave requires -op=%s", opInsert)
+		case cfg.noTruncate:
+			return errors.New("-interleave does not support -no-truncate")
+		}
+	}
+	// The lines would be mixed into a document that has to stay parseable
+	if cfg.stream && cfg.format != formatText && cfg.output == "" {
+		return fmt.Errorf("-stream requires -output with -format=%s", cfg.format)
+	}
+	if cfg.compressibility < 0 || cfg.compressibility > 100 {
+		return errors.New("-compressibility must be between 0 and 100")
+	}
+	if cfg.csvInput != "" && cfg.randomData {
+		return errors.New("-csv-input and -random-data are mutually exclusive")
+	}
+	if cfg.csvLoop && cfg.csvInput == "" {
+		return errors.New("-csv-loop requires -csv-input")
+	}
+	if cfg.pipelineDepth < 0 {
+		return errors.New("-pipeline-depth must not be negative")
+	}
+	if cfg.maxRetries > 0 && slices.Contains(cfg.methods, methodCopyStream) {
+		return fmt.Errorf("-method=%s does not support -max-retries, as it holds no rows to replay", methodCopyStream)
+	}
+	if cfg.pipelineDepth > 0 && !slices.Contains(cfg.methods, methodBatch) && !slices.Contains(cfg.methods, methodPrepared) {
+		return fmt.Errorf("-pipeline-depth requires -method=%s or %s", methodBatch, methodPrepared)
+	}
+	if cfg.savepointEvery < 0 {
+		return errors.New("-savepoint-every must not be negative")
+	}
+	if cfg.savepointEvery > 0 {
+		if cfg.op != opInsert {
+			return fmt.Errorf("-savepoint-every requires -op=%s", opInsert)
+		}
+		for _, m := range cfg.methods {
+			if m != methodBatch && m != methodPrepared {
+				return fmt.Errorf("-savepoint-every requires -method=%s or %s", methodBatch, methodPrepared)
+			}
+		}
+	}
+	if _, ok := execModes[cfg.execMode]; !ok {
+		return fmt.Errorf("unknown -exec-mode %q", cfg.execMode)
+	}
+	// The simple protocol has no named statements to execute
+	if cfg.execMode == execSimpleProtocol && slices.Contains(cfg.methods, methodPrepared) {
+		return fmt.Errorf("-method=%s does not work with -exec-mode=%s", methodPrepared, execSimpleProtocol)
+	}
+	for _, m := range cfg.methods {
+		if _, ok := insertMethods[m]; !ok {
+			return fmt.Errorf("unknown -method %q", m)
+		}
+	}
+	if cfg.nullRate < 0 || cfg.nullRate > 1 {
+		return errors.New("-null-rate must be between 0 and 1")
+	}
+	if cfg.conflictRate < 0 || cfg.conflictRate >= 1 {
+		return errors.New("-conflict-rate must be at least 0 and less than 1")
+	}
+	if slices.Contains(cfg.methods, methodUpsert) {
+		// Keys are numbered per sample, so rows inserted again by a
+		// time-bounded run would conflict unaccounted for
+		if cfg.duration > 0 {
+			return fmt.Errorf("-method=%s does not support -duration", methodUpsert)
+		}
+	} else if cfg.conflictRate > 0 {
+		return fmt.Errorf("-conflict-rate requires -method=%s", methodUpsert)
+	}
+	switch cfg.tableType {
+	case tableLogged, tableUnlogged:
+	case tableTemp:
+		if slices.Max(cfg.workerCounts) > 1 {
+			return fmt.Errorf("-table-type=%s requires a single worker, since the table only exists in one session", tableTemp)
+		}
+		// Temporary tables live in their own schema, which an unqualified
+		// name resolves to first
+		if strings.Contains(cfg.table, ".") {
+			return fmt.Errorf("-table-type=%s requires an unqualified -table", tableTemp)
+		}
+	default:
+		return fmt.Errorf("unknown -table-type %q", cfg.tableType)
+	}
+	switch cfg.pk {
+	case pkSerial, pkUUID, pkUUIDv7:
+	default:
+		return fmt.Errorf("unknown -pk %q", cfg.pk)
+	}
+	switch cfg.op {
+	case opInsert:
+	case opUpdate, opDelete, opMix:
+		if len(cfg.methods) != 1 || cfg.method != methodBatch {
+			return fmt.Errorf("-op=%s only supports -method=%s", cfg.op, methodBatch)
+		}
+		if cfg.prepopulateRows <= 0 {
+			return errors.New("-prepopulate-rows must be positive")
+		}
+		if cfg.pk != pkSerial {
+			return fmt.Errorf("-op=%s requires -pk=%s", cfg.op, pkSerial)
+		}
+	default:
+		return fmt.Errorf("unknown -op %q", cfg.op)
+	}
+	if (cfg.op == opDelete || cfg.op == opMix) && cfg.duration > 0 {
+		return fmt.Errorf("-op=%s does not support -duration", cfg.op)
+	}
+	if len(cfg.batchSizes) == 0 {
+		return errors.New("-batch-sizes must contain at least one value")
+	}
+	for _, b := range cfg.batchSizes {
+		if b <= 0 {
+			return fmt.Errorf("batch size %d must be positive", b)
+		}
+		if b > cfg.totalRows {
+			return fmt.Errorf("batch size %d exceeds total rows %d", b, cfg.totalRows)
+		}
+	}
+	return nil
+}
+
+// txSizeFor returns the number of rows committed per transaction when
+// testing the given batch size.
+func (cfg config) txSizeFor(batchSize int) int {
+	if cfg.txSize > 0 {
+		return cfg.txSize
+	}
+	return batchSize
+}
+
+// resolveDSN returns the connection string from the -dsn flag, falling back
+// to the DATABASE_URL environment variable, and checks that pgx can parse it.
+func resolveDSN(flagValue string) (string, error) {
+	dsn := flagValue
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_URL")
+	}
+	if dsn == "" {
+		return "", errors.New("a connection string is required: pass -dsn or set the DATABASE_URL environment variable")
+	}
+	if _, err := pgx.ParseConfig(dsn); err != nil {
+		return "", fmt.Errorf("invalid connection string: %w", err)
+	}
+	return dsn, nil
+}
+
+// redactDSN returns connString with its password masked, for display.
+// Both URLs and keyword/value connection strings are handled.
+func redactDSN(connString string) string {
+	if u, err := url.Parse(connString); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		if q.Has("password") {
+			q.Set("password", "xxxxx")
+			u.RawQuery = q.Encode()
+		}
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(connString, "${1}xxxxx")
+}
+
+// dsnPassword matches the password of a keyword/value connection string,
+// quoted or not.
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// warmupSizeFor returns the number of rows inserted per warmup transaction
+// when testing the given batch size.
+func (cfg config) warmupSizeFor(batchSize int) int {
+	if cfg.warmupRows > 0 {
+		return cfg.warmupRows
+	}
+	return batchSize
+}
+
+// warmupInsert returns the insert method of the warmup transactions: the
+// -warmup-method, or else the measured one, so that warmup exercises the
+// same server code paths. Update and delete runs insert with batch, and so
+// do upsert runs, whose rows only carry the keys they conflict on once
+// prepareUpsert has set them up.
+func (cfg config) warmupInsert() insertFunc {
+	switch {
+	case cfg.warmupMethod != "":
+		return insertMethods[cfg.warmupMethod]
+	case cfg.op == opInsert && cfg.method != methodUpsert:
+		return insertMethods[cfg.method]
+	}
+	return insertWithBatch
+}
+
+// keptSamples returns the sample rates that count towards the mean and
+// CV, which is all of them unless -reject-outliers is set.
+func (cfg config) keptSamples(rates []float64) []float64 {
+	if cfg.rejectOutliers {
+		return rejectOutliers(rates)
+	}
+	return rates
+}
+
+// tableIdentifier splits the configured table name on dots so that
+// schema-qualified names are quoted part by part.
+func (cfg config) tableIdentifier() pgx.Identifier {
+	return pgx.Identifier(strings.Split(cfg.table, "."))
+}
+
+// tableColumns returns the columns written to the table.
+func (cfg config) tableColumns() []string {
+	return tableColumns(cfg.pk != pkSerial, cfg.payloadKeys > 0, cfg.arrayLen > 0, cfg.blobSize > 0, cfg.columns, cfg.foreignKeys)
+}
+
+// isolationLevels maps the -isolation values to pgx isolation levels.
+var isolationLevels = map[string]pgx.TxIsoLevel{
+	"read-committed":  pgx.ReadCommitted,
+	"repeatable-read": pgx.RepeatableRead,
+	"serializable":    pgx.Serializable,
+}
+
+// Values of -exec-mode.
+const (
+	execCacheStatement = "cache_statement"
+	execCacheDescribe  = "cache_describe"
+	execDescribeExec   = "describe_exec"
+	execExec           = "exec"
+	execSimpleProtocol = "simple_protocol"
+)
+
+// execModes maps the -exec-mode values to pgx query exec modes.
+var execModes = map[string]pgx.QueryExecMode{
+	execCacheStatement: pgx.QueryExecModeCacheStatement,
+	execCacheDescribe:  pgx.QueryExecModeCacheDescribe,
+	execDescribeExec:   pgx.QueryExecModeDescribeExec,
+	execExec:           pgx.QueryExecModeExec,
+	execSimpleProtocol: pgx.QueryExecModeSimpleProtocol,
+}
+
+// serializationRetries is the -max-retries default under the isolation
+// levels that abort conflicting transactions.
+const serializationRetries = 10
+
+// txOptions returns the options transactions are started with.
+func (cfg config) txOptions() pgx.TxOptions {
+	opts := pgx.TxOptions{IsoLevel: isolationLevels[cfg.isolation]}
+	if cfg.asyncCommit {
+		// BEGIN is sent with the simple protocol, which allows the SET to
+		// ride along in the same round-trip
+		opts.BeginQuery = "BEGIN ISOLATION LEVEL " + strings.ToUpper(string(opts.IsoLevel)) + "; SET LOCAL synchronous_commit = off"
+	}
+	return opts
+}
+
+// insertOptions returns the options used to insert rows when testing the
+// given batch size.
+func (cfg config) insertOptions(batchSize int) insertOptions {
+	opts := insertOptions{
+		table:        cfg.tableIdentifier(),
+		columns:      cfg.tableColumns(),
+		batchSize:    batchSize,
+		txSize:       cfg.txSizeFor(batchSize),
+		txOptions:    cfg.txOptions(),
+		retries:      cfg.maxRetries,
+		pipeline:     cfg.pipelineDepth,
+		savepoint:    cfg.savepointEvery,
+		returning:    cfg.returning,
+		serverTiming: cfg.serverTiming,
+	}
+	return opts
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseBatchRange(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int // nil when the spec is invalid
+	}{
+		{"1:1000:10", []int{1, 10, 100, 1000}},
+		{"1000:8000:2", []int{1000, 2000, 4000, 8000}},
+		{"100:5000:10", []int{100, 1000}},
+		{"100:500:+100", []int{100, 200, 300, 400, 500}},
+		{"100:450:+100", []int{100, 200, 300, 400}},
+		{"10:100:2.5", []int{10, 25, 63}},
+		{"5:5:2", []int{5}},
+
+		{"", nil},
+		{"1:10", nil},
+		{"1:10:2:3", nil},
+		{"a:10:2", nil},
+		{"0:10:2", nil},
+		{"-1:10:2", nil},
+		{"10:1:2", nil},   // Reversed
+		{"1::2", nil},     // Empty max
+		{"1:10:", nil},    // Empty factor
+		{"1:10:1", nil},   // A factor of 1 never grows
+		{"1:10:0.5", nil}, // Shrinks
+		{"1:10:x", nil},
+		{"1:10:+0", nil},
+		{"1:10:+-2", nil},
+		{"1:10:+x", nil},
+		{"1:1000:1.1", nil}, // 1 and 1.1 both round to 1
+		{"1:1000:+1", nil},  // More than maxRangeSizes
+	}
+	for _, tt := range tests {
+		got, err := parseBatchRange(tt.spec)
+		switch {
+		case tt.want == nil && err == nil:
+			t.Errorf("parseBatchRange(%q) = %v, want an error", tt.spec, got)
+		case tt.want != nil && err != nil:
+			t.Errorf("parseBatchRange(%q) failed: %v", tt.spec, err)
+		case !slices.Equal(got, tt.want):
+			t.Errorf("parseBatchRange(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// methodCompare is the -method that measures batch and copy over the same
+// batch sizes, to find where COPY overtakes batched INSERTs.
+const methodCompare = "compare"
+
+// crossoverGroup is one set of -method=compare results that only differ
+// in method and batch size.
+type crossoverGroup struct {
+	server string
+	rest   string // resultLabel without the batch size
+	pairs  [][2]Result
+}
+
+// crossoverGroups pairs the batch results of -method=compare with the copy
+// ones measured with the same parameters, grouped by everything but the
+// batch size and sorted by it.
+func crossoverGroups(results []Result) []crossoverGroup {
+	type groupKey struct {
+		server string
+		params runParams
+	}
+	var groups []crossoverGroup
+	index := map[groupKey]int{}
+	for _, b := range results {
+		if !b.crossover || b.method != methodBatch {
+			continue
+		}
+		p := b.params()
+		p.method = methodCopy
+		c, ok := findResult(results, b.server, p)
+		if !ok {
+			continue
+		}
+		p.method, p.batchSize, p.txSize = "", 0, 0
+		key := groupKey{b.server, p}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			rest := strings.TrimPrefix(resultLabel(b), strconv.Itoa(b.batchSize))
+			groups = append(groups, crossoverGroup{server: b.server, rest: rest})
+		}
+		groups[i].pairs = append(groups[i].pairs, [2]Result{b, c})
+	}
+	for _, g := range groups {
+		slices.SortFunc(g.pairs, func(a, b [2]Result) int { return cmp.Compare(a[0].batchSize, b[0].batchSize) })
+	}
+	return groups
+}
+
+// crossover returns the index of the first of pairs from which copy is
+// faster than batch at every larger batch size, len(pairs) when batch
+// keeps up at the largest.
+func crossover(pairs [][2]Result) int {
+	i := len(pairs)
+	for i > 0 && pairs[i-1][1].rowsPerSec > pairs[i-1][0].rowsPerSec {
+		i--
+	}
+	return i
+}
+
+// displayCrossover prints, for the results of -method=compare, both
+// throughputs at each batch size, which method won and by how much, and
+// the batch size from which COPY stays ahead.
+func displayCrossover(w io.Writer, results []Result) {
+	for _, g := range crossoverGroups(results) {
+		heading := "COPY vs batch" + g.rest
+		if g.server != "" {
+			heading = g.server + " " + heading
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%s:\n", heading)
+		for _, pair := range g.pairs {
+			b, c := pair[0], pair[1]
+			winner, loser := c, b
+			if b.rowsPerSec >= c.rowsPerSec {
+				winner, loser = b, c
+			}
+			margin := 0.0
+			if loser.rowsPerSec > 0 {
+				margin = (winner.rowsPerSec/loser.rowsPerSec - 1) * 100
+			}
+			fmt.Fprintf(w, "  %-11d batch %10.0f, copy %10.0f rows/sec, %s faster by %.1f%%\n",
+				b.batchSize, b.rowsPerSec, c.rowsPerSec, winner.method, margin)
+		}
+		switch i := crossover(g.pairs); i {
+		case 0:
+			fmt.Fprintln(w, "  Crossover: copy is faster at every batch size")
+		case len(g.pairs):
+			fmt.Fprintln(w, "  Crossover: none, batch keeps up at the largest batch size")
+		default:
+			fmt.Fprintf(w, "  Crossover: copy overtakes batch from batch size %d\n", g.pairs[i][0].batchSize)
+		}
+	}
+}
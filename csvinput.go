@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// csvColumns are the header names -csv-input maps to the fields of a row.
+// Columns missing from the file are left empty or zero.
+var csvColumns = []string{"data", "description", "counter1", "counter2"}
+
+// csvIndexStride is the number of records between the file offsets that
+// csvRows remembers, trading memory for how far a stream has to read ahead
+// to reach its first row.
+const csvIndexStride = 1024
+
+// csvRows is a rowSource that reads rows from a CSV file with a header, as
+// it streams them, rather than holding the file in memory. Every
+// csvIndexStride-th record's offset is indexed when the file is opened, so
+// a stream starting at any row reads at most that many records to get
+// there. With loop set, rows past the end of the file start over from its
+// first row.
+type csvRows struct {
+	path    string
+	fields  []int   // Index into csvColumns of each of the file's columns
+	offsets []int64 // Offset of records 0, csvIndexStride, 2*csvIndexStride, ...
+	records int
+	n       int
+}
+
+// openCSVRows indexes the CSV file at path, checking that its header only
+// names csvColumns and that every record parses. The source has n rows:
+// with loop set it cycles through the records to get them, otherwise it is
+// cut short at the end of the file.
+func openCSVRows(path string, n int, loop bool) (csvRows, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return csvRows{}, err
+	}
+	defer f.Close()
+
+	c := csvRows{path: path}
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return csvRows{}, fmt.Errorf("failed to read the header of %s: %w", path, err)
+	}
+	for _, name := range header {
+		i := slices.Index(csvColumns, name)
+		if i < 0 {
+			return csvRows{}, fmt.Errorf("%s: unknown column %q, expected some of %v", path, name, csvColumns)
+		}
+		c.fields = append(c.fields, i)
+	}
+	for {
+		offset := r.InputOffset()
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return csvRows{}, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if _, err := c.parse(record); err != nil {
+			line, _ := r.FieldPos(0)
+			return csvRows{}, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if c.records%csvIndexStride == 0 {
+			c.offsets = append(c.offsets, offset)
+		}
+		c.records++
+	}
+	if c.records == 0 {
+		return csvRows{}, fmt.Errorf("%s holds no rows", path)
+	}
+	c.n = n
+	if !loop {
+		c.n = min(n, c.records)
+	}
+	return c, nil
+}
+
+// parse builds a row from one of the file's records.
+func (c csvRows) parse(record []string) (TestRow, error) {
+	var row TestRow
+	for i, value := range record {
+		var err error
+		switch csvColumns[c.fields[i]] {
+		case "data":
+			row.data = value
+		case "description":
+			row.description = value
+		case "counter1":
+			row.counter1, err = strconv.Atoi(value)
+		case "counter2":
+			row.counter2, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return TestRow{}, fmt.Errorf("invalid %s %q", csvColumns[c.fields[i]], value)
+		}
+	}
+	return row, nil
+}
+
+func (c csvRows) Len() int { return c.n }
+
+func (c csvRows) Stream(offset, n int) rowStream {
+	return &csvStream{rows: c, next: offset, end: offset + n}
+}
+
+// csvStream reads its rows from a file of its own, which it closes once
+// drained. The file was checked when it was indexed, so failing to read it
+// now means it changed under the benchmark; that ends the stream, with the
+// error returned by Err.
+type csvStream struct {
+	rows   csvRows
+	file   *os.File
+	reader *csv.Reader
+	record int // Index of the record the reader returns next
+	next   int
+	end    int
+	err    error
+}
+
+func (s *csvStream) Next() (TestRow, bool) {
+	if s.next >= s.end || s.err != nil {
+		s.Close()
+		return TestRow{}, false
+	}
+	row, err := s.read(s.next % s.rows.records)
+	if err != nil {
+		s.err = fmt.Errorf("failed to read -csv-input %s: %w", s.rows.path, err)
+		s.Close()
+		return TestRow{}, false
+	}
+	s.next++
+	return row, true
+}
+
+func (s *csvStream) Remaining() int { return s.end - s.next }
+func (s *csvStream) Err() error     { return s.err }
+
+// read returns the row of the given record, seeking back to it if the
+// reader has passed it.
+func (s *csvStream) read(want int) (TestRow, error) {
+	if s.reader == nil || want < s.record {
+		if err := s.seek(want); err != nil {
+			return TestRow{}, err
+		}
+	}
+	for {
+		record, err := s.reader.Read()
+		if err != nil {
+			return TestRow{}, err
+		}
+		s.record++
+		if s.record-1 == want {
+			return s.rows.parse(record)
+		}
+	}
+}
+
+// seek positions the reader at the indexed record at or before record.
+func (s *csvStream) seek(record int) error {
+	if s.file == nil {
+		f, err := os.Open(s.rows.path)
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+	k := record / csvIndexStride
+	if _, err := s.file.Seek(s.rows.offsets[k], io.SeekStart); err != nil {
+		return err
+	}
+	s.reader = csv.NewReader(s.file)
+	s.reader.FieldsPerRecord = len(s.rows.fields)
+	s.record = k * csvIndexStride
+	return nil
+}
+
+func (s *csvStream) Close() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+		s.reader = nil
+	}
+}
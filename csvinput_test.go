@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVStreamReportsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.csv")
+	content := "data,counter1\na,1\nb,2\nc,3\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := openCSVRows(path, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the file short after it was indexed
+	if err := os.WriteFile(path, []byte(strings.TrimSuffix(content, "c,3\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rows := src.Stream(0, 3)
+	defer rows.Close()
+	got, err := fill(rows, make([]TestRow, 3))
+	if len(got) != 2 || got[1].data != "b" {
+		t.Errorf("read %v before the end of the file, want rows a and b", got)
+	}
+	if err == nil || rows.Err() == nil {
+		t.Errorf("reading past the end of the changed file returned no error")
+	}
+	if _, ok := rows.Next(); ok {
+		t.Errorf("the stream yielded a row after failing")
+	}
+}
+
+func TestCSVStreamCloseBeforeDrained(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.csv")
+	if err := os.WriteFile(path, []byte("data\na\nb\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := openCSVRows(path, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := src.Stream(0, 2)
+	if _, ok := rows.Next(); !ok {
+		t.Fatal("the stream yielded no rows")
+	}
+	rows.Close()
+	if s := rows.(*csvStream); s.file != nil {
+		t.Errorf("Close left the file open")
+	}
+	rows.Close()
+}
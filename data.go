@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type TestRow struct {
+	id          int64       // Primary key of an existing row, for update and delete
+	kind        string      // Statement for the row under -op=mix: opInsert, opUpdate or opDelete
+	key         pgtype.UUID // Client-generated primary key, see -pk
+	data        string
+	description string
+	nullDesc    bool // Write NULL instead of description, see -null-rate
+	counter1    int
+	counter2    int
+	payload     string   // JSON document for the payload column, see -payload-keys
+	numbers     []int32  // Values of the numbers array column, see -array-len
+	blob        []byte   // Contents of the bytea blob column, see -blob-size
+	extra       []string // Values of the extra_N text columns, see -columns
+	parents     []int    // Values of the parent_N foreign key columns, see -foreign-keys
+}
+
+// size approximates the serialized size of the row: the lengths of its
+// non-NULL strings plus 8 bytes for each of the integer counters and 4 for
+// each array element.
+func (r TestRow) size() int {
+	n := len(r.data) + len(r.payload) + 16
+	if !r.nullDesc {
+		n += len(r.description)
+	}
+	n += 4*len(r.numbers) + len(r.blob)
+	if r.key.Valid {
+		n += len(r.key.Bytes)
+	}
+	for _, e := range r.extra {
+		n += len(e)
+	}
+	n += 8 * len(r.parents)
+	return n
+}
+
+// values appends the column values of the row to dst in the order of
+// tableColumns.
+func (r TestRow) values(dst []any) []any {
+	if r.key.Valid {
+		dst = append(dst, r.key)
+	}
+	var description any = r.description
+	if r.nullDesc {
+		description = (*string)(nil)
+	}
+	dst = append(dst, r.data, description, r.counter1, r.counter2)
+	if r.payload != "" {
+		dst = append(dst, r.payload)
+	}
+	if r.numbers != nil {
+		dst = append(dst, r.numbers)
+	}
+	if r.blob != nil {
+		dst = append(dst, r.blob)
+	}
+	for _, e := range r.extra {
+		dst = append(dst, e)
+	}
+	for _, p := range r.parents {
+		dst = append(dst, p)
+	}
+	return dst
+}
+
+// totalSize returns the sum of the sizes of rows.
+func totalSize(rows []TestRow) int {
+	n := 0
+	for _, r := range rows {
+		n += r.size()
+	}
+	return n
+}
+
+// rowStream yields benchmark rows one at a time.
+type rowStream interface {
+	// Next returns the next row, or false once the stream is exhausted.
+	Next() (TestRow, bool)
+	// Remaining returns the number of rows the stream has left to yield.
+	Remaining() int
+	// Err returns the error that cut the stream short, if any.
+	Err() error
+	// Close releases the stream's resources. It may be called before the
+	// stream is exhausted, and more than once.
+	Close()
+}
+
+// rowSource creates streams over a fixed, numbered set of rows. Rows are
+// produced on demand, so memory use is bounded by what the consumer holds
+// rather than by the number of rows.
+type rowSource interface {
+	// Len returns the number of distinct rows available.
+	Len() int
+	// Stream returns a stream of the n rows starting at offset.
+	Stream(offset, n int) rowStream
+}
+
+// generatedRows is a rowSource backed by a generator function that builds
+// row i from its index alone.
+type generatedRows struct {
+	n   int
+	gen func(i int) TestRow
+}
+
+func (g generatedRows) Len() int { return g.n }
+
+func (g generatedRows) Stream(offset, n int) rowStream {
+	return &generatedStream{gen: g.gen, next: offset, end: offset + n}
+}
+
+type generatedStream struct {
+	gen  func(i int) TestRow
+	next int
+	end  int
+}
+
+func (s *generatedStream) Next() (TestRow, bool) {
+	if s.next >= s.end {
+		return TestRow{}, false
+	}
+	row := s.gen(s.next)
+	s.next++
+	return row, true
+}
+
+func (s *generatedStream) Remaining() int { return s.end - s.next }
+func (s *generatedStream) Err() error     { return nil }
+func (s *generatedStream) Close()         {}
+
+// fill reads rows from s into buf and returns the filled prefix, which is
+// shorter than buf only when the stream runs out or fails.
+func fill(s rowStream, buf []TestRow) ([]TestRow, error) {
+	for i := range buf {
+		row, ok := s.Next()
+		if !ok {
+			return buf[:i], s.Err()
+		}
+		buf[i] = row
+	}
+	return buf, nil
+}
+
+// generateData returns n rows of repetitive, highly compressible text.
+func generateData(n int) rowSource {
+	return generatedRows{n: n, gen: func(i int) TestRow {
+		return TestRow{
+			data:        fmt.Sprintf("test data row %d", i),
+			description: fmt.Sprintf("description for row %d with some additional text to make it more realistic", i),
+			counter1:    i * 2,
+			counter2:    i * 3,
+		}
+	}}
+}
+
+const randomAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// generateRandomData returns n rows with pseudo-random text, so that TOAST
+// and WAL compression can't shrink the payload the way they do for the
+// repetitive strings from generateData. The description column carries
+// rowSize bytes, of which compressibility percent are a repeated byte that
+// compresses to almost nothing and the rest random. Each row is seeded
+// from seed and its index, so the same seed always yields the same rows.
+func generateRandomData(n, rowSize, compressibility int, seed uint64) rowSource {
+	repeated := strings.Repeat("x", rowSize*compressibility/100)
+	return generatedRows{n: n, gen: func(i int) TestRow {
+		rng := rand.New(rand.NewPCG(seed, uint64(i)))
+		return TestRow{
+			data:        randomString(rng, 16),
+			description: randomString(rng, rowSize-len(repeated)) + repeated,
+			counter1:    rng.IntN(1 << 31),
+			counter2:    rng.IntN(1 << 31),
+		}
+	}}
+}
+
+func randomString(rng *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randomAlphabet[rng.IntN(len(randomAlphabet))]
+	}
+	return string(b)
+}
+
+// sliceStream streams rows already held in memory.
+type sliceStream struct {
+	rows []TestRow
+}
+
+func (s *sliceStream) Next() (TestRow, bool) {
+	if len(s.rows) == 0 {
+		return TestRow{}, false
+	}
+	row := s.rows[0]
+	s.rows = s.rows[1:]
+	return row, true
+}
+
+func (s *sliceStream) Remaining() int { return len(s.rows) }
+func (s *sliceStream) Err() error     { return nil }
+func (s *sliceStream) Close()         {}
+
+// payloadRows is a rowSource that adds a flat JSON document to the rows of
+// src, alternating string and number fields.
+type payloadRows struct {
+	src  rowSource
+	keys int
+}
+
+func (p payloadRows) Len() int { return p.src.Len() }
+
+func (p payloadRows) Stream(offset, n int) rowStream {
+	return &payloadStream{rowStream: p.src.Stream(offset, n), keys: p.keys, next: offset}
+}
+
+type payloadStream struct {
+	rowStream
+	keys int
+	next int // Index of the next row, which seeds its document
+}
+
+func (s *payloadStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	row.payload = jsonPayload(s.next, s.keys)
+	s.next++
+	return row, true
+}
+
+// jsonPayload builds the document for row i with the given number of keys.
+func jsonPayload(i, keys int) string {
+	b := make([]byte, 0, keys*24)
+	b = append(b, '{')
+	for k := 0; k < keys; k++ {
+		if k > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, `"key_`...)
+		b = strconv.AppendInt(b, int64(k), 10)
+		b = append(b, `":`...)
+		if k%2 == 0 {
+			b = append(b, `"value_`...)
+			b = strconv.AppendInt(b, int64(i), 10)
+			b = append(b, '"')
+		} else {
+			b = strconv.AppendInt(b, int64(i*keys+k), 10)
+		}
+	}
+	b = append(b, '}')
+	return string(b)
+}
+
+// arrayRows is a rowSource that gives the rows of src an integer array of
+// n elements, derived from the row's index.
+type arrayRows struct {
+	src rowSource
+	n   int
+}
+
+func (a arrayRows) Len() int { return a.src.Len() }
+
+func (a arrayRows) Stream(offset, n int) rowStream {
+	return &arrayStream{rowStream: a.src.Stream(offset, n), n: a.n, next: offset}
+}
+
+type arrayStream struct {
+	rowStream
+	n    int
+	next int
+}
+
+func (s *arrayStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	row.numbers = make([]int32, s.n)
+	for i := range row.numbers {
+		row.numbers[i] = int32(s.next*s.n + i)
+	}
+	s.next++
+	return row, true
+}
+
+// blobRows is a rowSource that gives the rows of src size random bytes for
+// the blob column. They are seeded like generateRandomData, from a stream
+// of its own, and don't compress, so TOAST stores them as they are.
+type blobRows struct {
+	src  rowSource
+	size int
+	seed uint64
+}
+
+func (b blobRows) Len() int { return b.src.Len() }
+
+func (b blobRows) Stream(offset, n int) rowStream {
+	return &blobStream{rowStream: b.src.Stream(offset, n), size: b.size, seed: b.seed, next: offset}
+}
+
+type blobStream struct {
+	rowStream
+	size int
+	seed uint64
+	next int
+}
+
+func (s *blobStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	rng := rand.New(rand.NewPCG(^s.seed, uint64(s.next)))
+	row.blob = make([]byte, s.size)
+	for i := 0; i < len(row.blob); i += 8 {
+		var word [8]byte
+		binary.LittleEndian.PutUint64(word[:], rng.Uint64())
+		copy(row.blob[i:], word[:])
+	}
+	s.next++
+	return row, true
+}
+
+// widenedRows is a rowSource that adds n extra text columns to the rows of
+// src, each holding a copy of the row's description.
+type widenedRows struct {
+	src rowSource
+	n   int
+}
+
+func (w widenedRows) Len() int { return w.src.Len() }
+
+func (w widenedRows) Stream(offset, n int) rowStream {
+	return &widenedStream{rowStream: w.src.Stream(offset, n), n: w.n}
+}
+
+type widenedStream struct {
+	rowStream
+	n int
+}
+
+func (s *widenedStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	row.extra = make([]string, s.n)
+	for i := range row.extra {
+		row.extra[i] = row.description
+	}
+	return row, true
+}
+
+// nullRows is a rowSource that makes the description of the rows of src
+// NULL at the given rate, spreading the NULLs evenly.
+type nullRows struct {
+	src  rowSource
+	rate float64
+}
+
+func (r nullRows) Len() int { return r.src.Len() }
+
+func (r nullRows) Stream(offset, n int) rowStream {
+	return &nullStream{rowStream: r.src.Stream(offset, n), rate: r.rate, next: offset}
+}
+
+type nullStream struct {
+	rowStream
+	rate float64
+	next int
+}
+
+func (s *nullStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	row.nullDesc = int(float64(s.next+1)*s.rate) > int(float64(s.next)*s.rate)
+	s.next++
+	return row, true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// explainStats is the server-side accounting of an EXPLAIN (ANALYZE,
+// BUFFERS) run, or the mean of several.
+type explainStats struct {
+	rows        int // Rows in the explained INSERT
+	planning    time.Duration
+	execution   time.Duration
+	sharedHit   int64
+	sharedRead  int64
+	sharedDirty int64
+	runs        int
+}
+
+// add accumulates other into s; mean divides the sums by the number of
+// runs added.
+func (s *explainStats) add(other explainStats) {
+	s.rows = other.rows
+	s.planning += other.planning
+	s.execution += other.execution
+	s.sharedHit += other.sharedHit
+	s.sharedRead += other.sharedRead
+	s.sharedDirty += other.sharedDirty
+	s.runs++
+}
+
+func (s explainStats) mean() explainStats {
+	if s.runs == 0 {
+		return s
+	}
+	n := int64(s.runs)
+	return explainStats{
+		rows:        s.rows,
+		planning:    s.planning / time.Duration(n),
+		execution:   s.execution / time.Duration(n),
+		sharedHit:   s.sharedHit / n,
+		sharedRead:  s.sharedRead / n,
+		sharedDirty: s.sharedDirty / n,
+		runs:        s.runs,
+	}
+}
+
+// explainPlan is the part of the JSON output of EXPLAIN that is reported.
+type explainPlan struct {
+	Plan struct {
+		SharedHit   int64 `json:"Shared Hit Blocks"`
+		SharedRead  int64 `json:"Shared Read Blocks"`
+		SharedDirty int64 `json:"Shared Dirtied Blocks"`
+	} `json:"Plan"`
+	Planning  float64 `json:"Planning Time"`  // Milliseconds
+	Execution float64 `json:"Execution Time"` // Milliseconds
+}
+
+// explainBatch runs EXPLAIN (ANALYZE, BUFFERS) on a multi-row INSERT of one
+// batch of rows from src, outside any measurement, and rolls it back so
+// that the table is left as it was. The batch is capped like
+// insertWithMultiValues to fit the bind parameter limit.
+func explainBatch(ctx context.Context, pool *pgxpool.Pool, src rowSource, offset int, opts insertOptions) (explainStats, error) {
+	n := min(opts.batchSize, maxValuesRows(opts.columns), src.Len())
+	args := make([]any, 0, n*len(opts.columns))
+	rows := src.Stream(offset, n)
+	defer rows.Close()
+	for row, ok := rows.Next(); ok; row, ok = rows.Next() {
+		args = row.values(args)
+	}
+	if err := rows.Err(); err != nil {
+		return explainStats{}, err
+	}
+
+	tx, err := pool.BeginTx(ctx, opts.txOptions)
+	if err != nil {
+		return explainStats{}, err
+	}
+	defer rollback(tx)
+	var out []byte
+	sql := "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) " + multiValuesSQL(opts.table, opts.columns, n)
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&out); err != nil {
+		return explainStats{}, fmt.Errorf("failed to explain insert: %w", err)
+	}
+
+	var plans []explainPlan
+	if err := json.Unmarshal(out, &plans); err != nil {
+		return explainStats{}, fmt.Errorf("failed to parse EXPLAIN output: %w", err)
+	}
+	if len(plans) == 0 {
+		return explainStats{}, errors.New("EXPLAIN returned no plan")
+	}
+	p := plans[0]
+	return explainStats{
+		rows:        n,
+		planning:    time.Duration(p.Planning * float64(time.Millisecond)),
+		execution:   time.Duration(p.Execution * float64(time.Millisecond)),
+		sharedHit:   p.Plan.SharedHit,
+		sharedRead:  p.Plan.SharedRead,
+		sharedDirty: p.Plan.SharedDirty,
+	}, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fkParentRows is the number of rows in the parent table that the
+// -foreign-keys columns reference.
+const fkParentRows = 10_000
+
+// parentTable returns the table referenced by the foreign keys of table,
+// in the same schema.
+func parentTable(table pgx.Identifier) pgx.Identifier {
+	parent := slices.Clone(table)
+	parent[len(parent)-1] += "_parent"
+	return parent
+}
+
+// setupForeignKeys creates and fills the parent table of table and adds
+// the columns parent_1 to parent_<n> referencing it, which the migration
+// can't do since their number is only known at run time. The constraints
+// themselves are added by setForeignKeys.
+func setupForeignKeys(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, n int) error {
+	parent := parentTable(table).Sanitize()
+	if _, err := pool.Exec(ctx, "CREATE TABLE IF NOT EXISTS "+parent+" (id BIGINT PRIMARY KEY)"); err != nil {
+		return fmt.Errorf("failed to create parent table: %w", err)
+	}
+	_, err := pool.Exec(ctx, "INSERT INTO "+parent+" SELECT generate_series(1, $1) ON CONFLICT DO NOTHING", fkParentRows)
+	if err != nil {
+		return fmt.Errorf("failed to fill parent table: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("ALTER TABLE " + table.Sanitize())
+	for i, c := range parentColumns(n) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(" ADD COLUMN IF NOT EXISTS " + pgx.Identifier{c}.Sanitize() + " BIGINT")
+	}
+	if _, err := pool.Exec(ctx, b.String()); err != nil {
+		return fmt.Errorf("failed to add parent columns: %w", err)
+	}
+	return nil
+}
+
+// parentColumns returns the names of the n foreign key columns.
+func parentColumns(n int) []string {
+	columns := make([]string, n)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("parent_%d", i+1)
+	}
+	return columns
+}
+
+// setForeignKeys drops the foreign keys on table added by an earlier call,
+// and then, with enforce set, adds one for each of the n parent columns.
+// The table holds no rows between benchmarks, so adding them is cheap.
+func setForeignKeys(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, n int, enforce bool) error {
+	rows, err := pool.Query(ctx, `
+		SELECT conname FROM pg_constraint
+		WHERE conrelid = $1::regclass AND contype = 'f' AND conname LIKE '%\_pscale\_fk\_%'`, table.Sanitize())
+	if err != nil {
+		return err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := pool.Exec(ctx, "ALTER TABLE "+table.Sanitize()+" DROP CONSTRAINT "+pgx.Identifier{name}.Sanitize()); err != nil {
+			return fmt.Errorf("failed to drop foreign key: %w", err)
+		}
+	}
+	if !enforce {
+		return nil
+	}
+
+	parent := parentTable(table).Sanitize()
+	for i, c := range parentColumns(n) {
+		name := pgx.Identifier{fmt.Sprintf("%s_pscale_fk_%d", table[len(table)-1], i+1)}
+		sql := "ALTER TABLE " + table.Sanitize() + " ADD CONSTRAINT " + name.Sanitize() +
+			" FOREIGN KEY (" + pgx.Identifier{c}.Sanitize() + ") REFERENCES " + parent + " (id)"
+		if _, err := pool.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("failed to add foreign key: %w", err)
+		}
+	}
+	return nil
+}
+
+// referencingRows is a rowSource that gives the rows of src n parent ids,
+// spread over the rows of the parent table.
+type referencingRows struct {
+	src rowSource
+	n   int
+}
+
+func (r referencingRows) Len() int { return r.src.Len() }
+
+func (r referencingRows) Stream(offset, n int) rowStream {
+	return &referencingStream{rowStream: r.src.Stream(offset, n), n: r.n, next: offset}
+}
+
+type referencingStream struct {
+	rowStream
+	n    int
+	next int
+}
+
+func (s *referencingStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	row.parents = make([]int, s.n)
+	for i := range row.parents {
+		row.parents[i] = (s.next+i)%fkParentRows + 1
+	}
+	s.next++
+	return row, true
+}
+
+// displayForeignKeyCost prints, for each result measured with the
+// -foreign-keys constraints enforced, what the checks cost per row
+// compared with the same run without the constraints.
+func displayForeignKeyCost(w io.Writer, results []Result) {
+	header := false
+	for _, fk := range results {
+		if !fk.fkEnforced {
+			continue
+		}
+		p := fk.params()
+		p.fkEnforced = false
+		plain, ok := findResult(results, fk.server, p)
+		if !ok || plain.rowsPerSec == 0 || fk.rowsPerSec == 0 {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "Foreign key cost (%d foreign keys referencing %d rows):\n", fk.foreignKeys, fkParentRows)
+			header = true
+		}
+		label := fk.method + " " + resultLabel(plain)
+		if fk.server != "" {
+			label = fk.server + " " + label
+		}
+		perRow := (1/fk.rowsPerSec - 1/plain.rowsPerSec) * 1e6
+		fmt.Fprintf(w, "  %-20s %12.0f -> %12.0f rows/sec, %.2f µs/row, %.2f µs per check\n",
+			label, plain.rowsPerSec, fk.rowsPerSec, perRow, perRow/float64(fk.foreignKeys))
+	}
+}
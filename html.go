@@ -0,0 +1,136 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+//go:embed templates/report.html.tmpl
+var templateFS embed.FS
+
+var reportTemplate = template.Must(template.ParseFS(templateFS, "templates/report.html.tmpl"))
+
+// Layout of the SVG bar chart, in pixels.
+const (
+	chartLabelWidth = 140
+	chartBarWidth   = 500
+	chartBarHeight  = 20
+	chartBarGap     = 8
+	chartValueWidth = 90
+)
+
+type htmlReport struct {
+	Op, Method    string
+	TableType     string
+	Label         string
+	Hostname      string
+	Started       string
+	Servers       []htmlServer
+	Width, Height int
+	BarX          int
+	BarHeight     int
+	Bars          []htmlBar
+	Rows          []htmlRow
+}
+
+type htmlServer struct {
+	Number                    int // Set when comparing several servers
+	Name, ServerVersion, Host string
+	Transport                 string
+	Settings                  []htmlSetting
+}
+
+type htmlSetting struct {
+	Name, Value string
+}
+
+type htmlBar struct {
+	Label         string
+	Y, TextY      int
+	Width, ValueX int
+	Value         string
+}
+
+type htmlRow struct {
+	Label      string
+	RowsPerSec string
+	CI95       string
+	Speedup    string
+	CV         string
+	MBPerSec   string
+	P99        string
+	Samples    int
+}
+
+// writeHTML renders results as a self-contained HTML page with an SVG bar
+// chart, scaled to the highest throughput like the text histogram, and a
+// table of the numbers.
+func writeHTML(w io.Writer, info runInfo, results []Result) error {
+	report := htmlReport{
+		Started:   info.started.UTC().Format(time.RFC3339),
+		Label:     info.label,
+		Hostname:  info.hostname,
+		Width:     chartLabelWidth + chartBarWidth + chartValueWidth,
+		Height:    len(results) * (chartBarHeight + chartBarGap),
+		BarX:      chartLabelWidth,
+		BarHeight: chartBarHeight,
+	}
+	for i, server := range info.servers {
+		hs := htmlServer{Name: server.name, ServerVersion: server.serverVersion, Host: server.host, Transport: server.transport}
+		if len(info.servers) > 1 {
+			hs.Number = i + 1
+		}
+		for _, s := range server.settings {
+			hs.Settings = append(hs.Settings, htmlSetting{Name: s.name, Value: s.value})
+		}
+		report.Servers = append(report.Servers, hs)
+	}
+	labels := newLabeler(results)
+	results = groupByParameters(results)
+	if len(results) > 0 {
+		report.Op, report.Method = results[0].op, strings.Join(labels.methods, ", ")
+		report.TableType = results[0].tableType
+	}
+
+	maxThroughput := 0.0
+	for _, r := range results {
+		maxThroughput = max(maxThroughput, r.rowsPerSec)
+	}
+
+	for i, r := range results {
+		width := 0
+		if maxThroughput > 0 {
+			width = int(r.rowsPerSec / maxThroughput * chartBarWidth)
+		}
+		y := i * (chartBarHeight + chartBarGap)
+		report.Bars = append(report.Bars, htmlBar{
+			Label:  labels.label(r),
+			Y:      y,
+			TextY:  y + chartBarHeight*3/4,
+			Width:  width,
+			ValueX: chartLabelWidth + width + 6,
+			Value:  fmt.Sprintf("%.0f", r.rowsPerSec),
+		})
+
+		cv := 0.0
+		if r.rowsPerSec > 0 {
+			cv = r.stdDev / r.rowsPerSec * 100
+		}
+		report.Rows = append(report.Rows, htmlRow{
+			Label:      labels.label(r),
+			RowsPerSec: fmt.Sprintf("%.0f", r.rowsPerSec),
+			CI95:       fmt.Sprintf("%.0f", r.ci95),
+			Speedup:    fmt.Sprintf("%.1f×", r.speedup),
+			CV:         fmt.Sprintf("%.1f", cv),
+			MBPerSec:   fmt.Sprintf("%.1f", r.bytesPerSec/1e6),
+			P99:        r.latency.p99.Round(time.Microsecond).String(),
+			Samples:    r.samples,
+		})
+	}
+
+	return reportTemplate.Execute(w, report)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// createSecondaryIndexes creates n single-column indexes on table, cycling
+// through its columns other than the key and the blob, so that n may
+// exceed the number of columns. Postgres puts the indexes in the table's
+// schema.
+func createSecondaryIndexes(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, columns []string, n int) error {
+	// Blobs exceed the size of a btree entry
+	columns = slices.DeleteFunc(slices.Clone(columns), func(c string) bool { return c == "id" || c == "blob" })
+	for i := 1; i <= n; i++ {
+		name := pgx.Identifier{fmt.Sprintf("%s_pscale_idx_%d", table[len(table)-1], i)}
+		column := pgx.Identifier{columns[(i-1)%len(columns)]}
+		sql := "CREATE INDEX " + name.Sanitize() + " ON " + table.Sanitize() + " (" + column.Sanitize() + ")"
+		if _, err := pool.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
+
+// dropSecondaryIndexes drops the indexes on table created by
+// createSecondaryIndexes, including any left over from earlier runs with
+// more of them.
+func dropSecondaryIndexes(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier) error {
+	rows, err := pool.Query(ctx, `
+		SELECT c.relname FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		WHERE i.indrelid = $1::regclass AND c.relname LIKE '%\_pscale\_idx\_%'`, table.Sanitize())
+	if err != nil {
+		return err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		index := slices.Clone(table)
+		index[len(index)-1] = name
+		if _, err := pool.Exec(ctx, "DROP INDEX "+index.Sanitize()); err != nil {
+			return fmt.Errorf("failed to drop index: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,732 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	methodBatch       = "batch"
+	methodCopy        = "copy"
+	methodCopyBinary  = "copy-binary"
+	methodCopyText    = "copy-text"
+	methodCopyStream  = "copy-stream"
+	methodMultiValues = "values"
+	methodPrepared    = "prepared"
+	methodUpsert      = "upsert"
+)
+
+// maxBindParams is Postgres's limit on the parameters of one statement.
+const maxBindParams = 65535
+
+// maxValuesRows returns the most rows of columns values that fit in one
+// statement's maxBindParams.
+func maxValuesRows(columns []string) int {
+	return maxBindParams / len(columns)
+}
+
+// insertStats describes the timing of a single insertFunc call.
+type insertStats struct {
+	elapsed    time.Duration
+	rows       int             // Rows inserted
+	bytes      int             // Approximate payload bytes inserted
+	latencies  []time.Duration // Begin-to-commit time of each transaction
+	serverTime time.Duration   // Sum of the transactions' serverTxTime, see -server-timing
+	retries    int             // Transactions replayed after a retryable error
+	workers    []workerStats   // Share of each worker, when run concurrently
+}
+
+// workerStats is what one of several concurrent workers wrote, and for how
+// long it ran.
+type workerStats struct {
+	rows    int
+	elapsed time.Duration
+}
+
+// addWorkerStats adds the rows and time of each worker in more to the same
+// worker's totals.
+func addWorkerStats(totals, more []workerStats) []workerStats {
+	for i, w := range more {
+		if i == len(totals) {
+			totals = append(totals, workerStats{})
+		}
+		totals[i].rows += w.rows
+		totals[i].elapsed += w.elapsed
+	}
+	return totals
+}
+
+// workerRates returns the rows/sec of each worker.
+func workerRates(workers []workerStats) []float64 {
+	var rates []float64
+	for _, w := range workers {
+		rate := 0.0
+		if w.elapsed > 0 {
+			rate = float64(w.rows) / w.elapsed.Seconds()
+		}
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+// add merges the counters and latencies of other into s.
+func (s *insertStats) add(other insertStats) {
+	s.rows += other.rows
+	s.bytes += other.bytes
+	s.retries += other.retries
+	s.latencies = append(s.latencies, other.latencies...)
+	s.serverTime += other.serverTime
+}
+
+// insertOptions controls how an insertFunc writes rows.
+type insertOptions struct {
+	table        pgx.Identifier
+	columns      []string // Columns written, in the order of TestRow.values
+	batchSize    int      // Rows sent per round-trip
+	txSize       int      // Rows committed per transaction
+	txOptions    pgx.TxOptions
+	retries      int  // Times a transaction is replayed after a retryable error
+	pipeline     int  // Statements sent per pgx.Batch by the pipelined methods, 0 for the whole batch
+	savepoint    int  // Rows wrapped in each savepoint by the pipelined methods, 0 for none
+	returning    bool // Whether inserts return the ids of their rows, which are read back
+	serverTiming bool // Whether each transaction reads its serverTxTime before committing
+}
+
+// insertFunc inserts every row from rows into opts.table in transactions
+// of opts.txSize rows each, sending opts.batchSize rows per round-trip.
+type insertFunc func(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error)
+
+var insertMethods = map[string]insertFunc{
+	methodBatch:       insertWithBatch,
+	methodCopy:        insertWithCopy,
+	methodCopyBinary:  insertWithCopy,
+	methodCopyText:    insertWithCopyText,
+	methodCopyStream:  insertWithCopyStream,
+	methodMultiValues: insertWithMultiValues,
+	methodPrepared:    insertWithPrepared,
+	methodUpsert:      insertWithUpsert,
+}
+
+var testDataColumns = []string{"data", "description", "counter1", "counter2"}
+
+// tableColumns returns the id column if key is set, testDataColumns, the
+// payload column if payload is set, the numbers column if array is set, the
+// blob column if blob is set, the names of extra text columns, extra_1
+// to extra_<extra>, and the names of the foreign key columns, parent_1 to
+// parent_<parents>.
+func tableColumns(key, payload, array, blob bool, extra, parents int) []string {
+	var columns []string
+	if key {
+		columns = append(columns, "id")
+	}
+	columns = append(columns, testDataColumns...)
+	if payload {
+		columns = append(columns, "payload")
+	}
+	if array {
+		columns = append(columns, "numbers")
+	}
+	if blob {
+		columns = append(columns, "blob")
+	}
+	for i := 1; i <= extra; i++ {
+		columns = append(columns, fmt.Sprintf("extra_%d", i))
+	}
+	return append(columns, parentColumns(parents)...)
+}
+
+// columnList quotes columns and joins them for use in a statement.
+func columnList(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = pgx.Identifier{c}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// insertSQL returns the single-row INSERT statement for table.
+func insertSQL(table pgx.Identifier, columns []string) string {
+	return multiValuesSQL(table, columns, 1)
+}
+
+// returningSQL appends a RETURNING clause for the ids of the rows to the
+// INSERT statement sql when opts asks for it.
+func returningSQL(sql string, opts insertOptions) string {
+	if opts.returning {
+		return sql + " RETURNING id"
+	}
+	return sql
+}
+
+// rollback aborts tx using a fresh context, so that transactions abandoned
+// because the benchmark context was cancelled are still rolled back.
+func rollback(tx pgx.Tx) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = tx.Rollback(ctx)
+}
+
+// sendFunc writes one batch of rows within tx.
+type sendFunc func(ctx context.Context, tx pgx.Tx, batch []TestRow) error
+
+// txBeginner starts transactions; both *pgxpool.Pool and *pgxpool.Conn
+// implement it.
+type txBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// runTransactions is the loop shared by the insert methods. It reads rows
+// into batches of at most opts.batchSize, groups the batches into
+// transactions of opts.txSize rows started on db, and hands each batch to
+// send. Only one batch is held in memory at a time, except when
+// opts.retries is set: then each transaction's rows are kept so that a
+// transaction that failed with a retryable error can be replayed. When ctx
+// times out, the error names the batch that was being sent.
+func runTransactions(ctx context.Context, db txBeginner, rows rowStream, opts insertOptions, send sendFunc) (insertStats, error) {
+	var stats insertStats
+	start := time.Now()
+
+	batches := 0
+	counted := func(ctx context.Context, tx pgx.Tx, batch []TestRow) error {
+		batches++
+		return send(ctx, tx, batch)
+	}
+
+	// Short streams, such as a final partial sample, need no more than
+	// their rows
+	buf := make([]TestRow, min(opts.batchSize, opts.txSize, rows.Remaining()))
+	var txBuf []TestRow
+	if opts.retries > 0 {
+		txBuf = make([]TestRow, min(opts.txSize, rows.Remaining()))
+	}
+
+	for {
+		txStart := time.Now()
+		var inTx, bytes int
+		var server time.Duration
+		var err error
+		if txBuf == nil {
+			var batch []TestRow
+			if batch, err = fill(rows, buf); err != nil {
+				return insertStats{}, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+			inTx, bytes, server, err = sendTransaction(ctx, db, batch, rows, buf, opts, counted)
+		} else {
+			var txRows []TestRow
+			if txRows, err = fill(rows, txBuf); err != nil {
+				return insertStats{}, err
+			}
+			if len(txRows) == 0 {
+				break
+			}
+			for attempt := 0; ; attempt++ {
+				replay := &sliceStream{rows: txRows}
+				batch, _ := fill(replay, buf)
+				inTx, bytes, server, err = sendTransaction(ctx, db, batch, replay, buf, opts, counted)
+				if err == nil || attempt >= opts.retries || ctx.Err() != nil || !isRetryable(err) {
+					break
+				}
+				stats.retries++
+				if err = sleepBackoff(ctx, attempt); err != nil {
+					break
+				}
+			}
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return insertStats{}, fmt.Errorf("stalled at batch %d, after %d rows: %w", batches, stats.rows, err)
+		}
+		if err != nil {
+			return insertStats{}, err
+		}
+		stats.latencies = append(stats.latencies, time.Since(txStart))
+		stats.rows += inTx
+		stats.bytes += bytes
+		stats.serverTime += server
+		rowsCommitted.Add(int64(inTx))
+	}
+
+	stats.elapsed = time.Since(start)
+	return stats, nil
+}
+
+// sendTransaction sends batch, followed by further batches read from rows
+// into buf, within one transaction of at most opts.txSize rows. It returns
+// the number of rows and payload bytes committed, and with
+// opts.serverTiming the transaction's serverTxTime.
+func sendTransaction(ctx context.Context, db txBeginner, batch []TestRow, rows rowStream, buf []TestRow, opts insertOptions, send sendFunc) (int, int, time.Duration, error) {
+	tx, err := db.BeginTx(ctx, opts.txOptions)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	inTx, bytes := 0, 0
+	for len(batch) > 0 {
+		if err := send(ctx, tx, batch); err != nil {
+			rollback(tx)
+			return 0, 0, 0, err
+		}
+		inTx += len(batch)
+		bytes += totalSize(batch)
+
+		if inTx >= opts.txSize {
+			break
+		}
+		if batch, err = fill(rows, buf[:min(len(buf), opts.txSize-inTx)]); err != nil {
+			rollback(tx)
+			return 0, 0, 0, err
+		}
+	}
+
+	var server time.Duration
+	if opts.serverTiming {
+		if server, err = serverTxTime(ctx, tx); err != nil {
+			rollback(tx)
+			return 0, 0, 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, 0, err
+	}
+	return inTx, bytes, server, nil
+}
+
+// isRetryable reports whether the transaction that failed with err may
+// succeed when replayed: it conflicted with a concurrent transaction, or
+// the connection failed or was shut down by the server.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+		// Class 08 covers connection exceptions
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// sleepBackoff waits before retry attempt+1, doubling the delay with each
+// attempt from 10ms up to a second. It returns early if ctx is cancelled.
+func sleepBackoff(ctx context.Context, attempt int) error {
+	return sleepContext(ctx, min(10*time.Millisecond<<attempt, time.Second))
+}
+
+// sleepContext sleeps for d, returning early with the error of ctx when it
+// is cancelled.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// insertRows inserts the n rows of src starting at offset with ins, in
+// batches of batchSize, closing their stream afterwards.
+func insertRows(ctx context.Context, ins Inserter, src rowSource, offset, n, batchSize int) (insertStats, error) {
+	rows := src.Stream(offset, n)
+	defer rows.Close()
+	return ins.Insert(ctx, rows, batchSize)
+}
+
+// insertConcurrently splits the n rows of src starting at offset into
+// contiguous ranges, one per worker, and inserts each range from its own
+// goroutine. The first error cancels the remaining workers.
+func insertConcurrently(ctx context.Context, ins Inserter, src rowSource, offset, n int, opts insertOptions, workers int) (insertStats, error) {
+	if workers <= 1 {
+		return insertRows(ctx, ins, src, offset, n, opts.batchSize)
+	}
+
+	perWorker := make([]insertStats, workers)
+	chunk := (n + workers - 1) / workers
+	start := time.Now()
+
+	g, gctx := errgroup.WithContext(ctx)
+	for w := 0; w < workers; w++ {
+		lo := min(w*chunk, n)
+		hi := min(lo+chunk, n)
+		g.Go(func() error {
+			stats, err := insertRows(gctx, ins, src, offset+lo, hi-lo, opts.batchSize)
+			perWorker[w] = stats
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return insertStats{}, err
+	}
+
+	stats := insertStats{elapsed: time.Since(start)}
+	for _, s := range perWorker {
+		stats.add(s)
+		stats.workers = append(stats.workers, workerStats{rows: s.rows, elapsed: s.elapsed})
+	}
+	return stats, nil
+}
+
+// timedStats summarizes an insertUntil run.
+type timedStats struct {
+	insertStats
+	txRates []float64       // Rows per second of each committed transaction
+	lags    []time.Duration // How late each transaction started, under -target-rate
+}
+
+// insertUntil keeps inserting transactions of opts.txSize rows from src
+// until deadline passes, cycling through the rows as needed. Each worker
+// works through its own contiguous range of rows.
+func insertUntil(ctx context.Context, ins Inserter, src rowSource, opts insertOptions, workers int, deadline time.Time) (timedStats, error) {
+	perWorker := make([]timedStats, workers)
+	chunk := (src.Len() + workers - 1) / workers
+	start := time.Now()
+
+	g, gctx := errgroup.WithContext(ctx)
+	for w := 0; w < workers; w++ {
+		lo := min(w*chunk, src.Len())
+		hi := min(lo+chunk, src.Len())
+		if lo == hi {
+			continue
+		}
+		g.Go(func() error {
+			ws := &perWorker[w]
+			for cursor := lo; time.Now().Before(deadline); {
+				if cursor >= hi {
+					cursor = lo
+				}
+				n := min(opts.txSize, hi-cursor)
+				stats, err := insertRows(gctx, ins, src, cursor, n, opts.batchSize)
+				if err != nil {
+					return err
+				}
+				ws.add(stats)
+				ws.txRates = append(ws.txRates, float64(stats.rows)/stats.elapsed.Seconds())
+				cursor += n
+			}
+			ws.elapsed = time.Since(start)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return timedStats{}, err
+	}
+
+	var total timedStats
+	total.elapsed = time.Since(start)
+	for _, ws := range perWorker {
+		total.add(ws.insertStats)
+		total.txRates = append(total.txRates, ws.txRates...)
+		if workers > 1 {
+			total.workers = append(total.workers, workerStats{rows: ws.rows, elapsed: ws.elapsed})
+		}
+	}
+	return total, nil
+}
+
+func insertWithBatch(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	sql := returningSQL(insertSQL(opts.table, opts.columns), opts)
+
+	// Use pgx.Batch for efficient pipelining within the transaction
+	return runTransactions(ctx, pool, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		return sendPipelined(ctx, tx, sql, rows, opts)
+	})
+}
+
+// sendPipelined executes sql once for each of rows as a pgx.Batch, waiting
+// for the results of every opts.pipeline statements before sending more. A
+// depth of 0 sends them all at once. With opts.savepoint set, every
+// savepoint rows are wrapped in a SAVEPOINT and RELEASE SAVEPOINT, queued
+// in the same pipeline. With opts.returning, the id each statement returns
+// is read.
+func sendPipelined(ctx context.Context, tx pgx.Tx, sql string, rows []TestRow, opts insertOptions) error {
+	depth, savepoint := opts.pipeline, opts.savepoint
+	if depth == 0 {
+		depth = len(rows)
+	}
+	var id any
+	scanID := func(row pgx.Row) error { return row.Scan(&id) }
+	sent := 0
+	for chunk := range slices.Chunk(rows, max(depth, 1)) {
+		batch := &pgx.Batch{}
+		for _, row := range chunk {
+			if savepoint > 0 && sent%savepoint == 0 {
+				batch.Queue("SAVEPOINT pscale")
+			}
+			q := batch.Queue(sql, row.values(nil)...)
+			if opts.returning {
+				q.QueryRow(scanID)
+			}
+			sent++
+			if savepoint > 0 && (sent%savepoint == 0 || sent == len(rows)) {
+				batch.Queue("RELEASE SAVEPOINT pscale")
+			}
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertWithCopy loads rows using the COPY protocol, issuing one CopyFrom
+// per batch inside each transaction.
+func insertWithCopy(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	return runTransactions(ctx, pool, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		_, err := tx.CopyFrom(ctx, opts.table, opts.columns,
+			pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+				return rows[i].values(nil), nil
+			}))
+		return err
+	})
+}
+
+// insertWithCopyStream loads each transaction's opts.txSize rows with a
+// single CopyFrom, pulling them from rows one at a time through
+// pgx.CopyFromFunc as pgx encodes them, so that no batch is ever
+// materialized and opts.batchSize only matters through the default
+// opts.txSize. Without the rows at hand a failed transaction can't be
+// replayed, so opts.retries must be 0.
+func insertWithCopyStream(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	var stats insertStats
+	start := time.Now()
+	var values []any
+
+	for {
+		first, ok := rows.Next()
+		if !ok {
+			if err := rows.Err(); err != nil {
+				return insertStats{}, err
+			}
+			break
+		}
+		txStart := time.Now()
+		inTx, bytes := 0, 0
+		next := func() ([]any, error) {
+			row := first
+			if inTx > 0 {
+				if inTx >= opts.txSize {
+					return nil, nil
+				}
+				if row, ok = rows.Next(); !ok {
+					return nil, rows.Err()
+				}
+			}
+			inTx++
+			bytes += row.size()
+			values = row.values(values[:0])
+			return values, nil
+		}
+
+		tx, err := pool.BeginTx(ctx, opts.txOptions)
+		if err != nil {
+			return insertStats{}, err
+		}
+		if _, err := tx.CopyFrom(ctx, opts.table, opts.columns, pgx.CopyFromFunc(next)); err != nil {
+			rollback(tx)
+			if errors.Is(err, context.DeadlineExceeded) {
+				return insertStats{}, fmt.Errorf("stalled after %d rows: %w", stats.rows+inTx, err)
+			}
+			return insertStats{}, err
+		}
+		if opts.serverTiming {
+			server, err := serverTxTime(ctx, tx)
+			if err != nil {
+				rollback(tx)
+				return insertStats{}, err
+			}
+			stats.serverTime += server
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return insertStats{}, err
+		}
+		stats.latencies = append(stats.latencies, time.Since(txStart))
+		stats.rows += inTx
+		stats.bytes += bytes
+		rowsCommitted.Add(int64(inTx))
+	}
+
+	stats.elapsed = time.Since(start)
+	return stats, nil
+}
+
+// insertWithCopyText loads rows with COPY in the text format, which pgx's
+// CopyFrom never uses, encoding each batch by hand and streaming it over
+// the transaction's connection.
+func insertWithCopyText(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	sql := "COPY " + opts.table.Sanitize() + " (" + columnList(opts.columns) + ") FROM STDIN"
+	var buf bytes.Buffer
+	var values []any
+
+	return runTransactions(ctx, pool, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		buf.Reset()
+		for _, row := range rows {
+			values = row.values(values[:0])
+			for i, v := range values {
+				if i > 0 {
+					buf.WriteByte('\t')
+				}
+				appendCopyText(&buf, v)
+			}
+			buf.WriteByte('\n')
+		}
+		_, err := tx.Conn().PgConn().CopyFrom(ctx, &buf, sql)
+		return err
+	})
+}
+
+// appendCopyText writes v to buf in the COPY text format.
+func appendCopyText(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case *string:
+		if v == nil {
+			buf.WriteString(`\N`)
+			return
+		}
+		appendCopyText(buf, *v)
+	case string:
+		for i := 0; i < len(v); i++ {
+			switch c := v[i]; c {
+			case '\\':
+				buf.WriteString(`\\`)
+			case '\t':
+				buf.WriteString(`\t`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case []byte:
+		// The hex format, with its backslash escaped for COPY
+		buf.WriteString(`\\x`)
+		buf.WriteString(hex.EncodeToString(v))
+	case []int32:
+		buf.WriteByte('{')
+		for i, n := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatInt(int64(n), 10))
+		}
+		buf.WriteByte('}')
+	case pgtype.UUID:
+		fmt.Fprintf(buf, "%x-%x-%x-%x-%x", v.Bytes[0:4], v.Bytes[4:6], v.Bytes[6:8], v.Bytes[8:10], v.Bytes[10:16])
+	default:
+		fmt.Fprint(buf, v)
+	}
+}
+
+// insertWithPrepared explicitly prepares the INSERT once on a dedicated
+// connection and executes the named statement for every row, pipelined in
+// batches.
+func insertWithPrepared(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	const stmtName = "pscale_insert"
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return insertStats{}, err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Conn().Prepare(ctx, stmtName, returningSQL(insertSQL(opts.table, opts.columns), opts)); err != nil {
+		return insertStats{}, err
+	}
+
+	return runTransactions(ctx, conn, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		return sendPipelined(ctx, tx, stmtName, rows, opts)
+	})
+}
+
+// insertWithMultiValues inserts each batch as a single
+// INSERT ... VALUES (...), (...) statement, reading the returned ids with
+// -returning. Statements are capped at maxValuesRows, so a larger batch
+// size turns into several statements within the same transaction rather
+// than one the server rejects.
+func insertWithMultiValues(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	return insertMultiValues(ctx, pool, rows, opts)
+}
+
+// insertMultiValues is insertWithMultiValues on any txBeginner.
+func insertMultiValues(ctx context.Context, db txBeginner, rows rowStream, opts insertOptions) (insertStats, error) {
+	opts.batchSize = min(opts.batchSize, maxValuesRows(opts.columns))
+	args := make([]any, 0, opts.batchSize*len(opts.columns))
+	var sql string
+	var sqlTuples int
+	var id any
+
+	return runTransactions(ctx, db, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		if len(rows) != sqlTuples {
+			sql = returningSQL(multiValuesSQL(opts.table, opts.columns, len(rows)), opts)
+			sqlTuples = len(rows)
+		}
+
+		args = args[:0]
+		for _, row := range rows {
+			args = row.values(args)
+		}
+
+		if opts.returning {
+			returned, err := tx.Query(ctx, sql, args...)
+			if err != nil {
+				return err
+			}
+			_, err = pgx.ForEachRow(returned, []any{&id}, func() error { return nil })
+			return err
+		}
+		_, err := tx.Exec(ctx, sql, args...)
+		return err
+	})
+}
+
+// multiValuesSQL builds an INSERT statement into the columns of table with
+// placeholders for n rows.
+func multiValuesSQL(table pgx.Identifier, columns []string, n int) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO " + table.Sanitize() + " (" + columnList(columns) + ") VALUES ")
+	p := 0
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j := range columns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			p++
+			fmt.Fprintf(&b, "$%d", p)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
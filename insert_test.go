@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// recordingTx is a pgx.Tx that records the statements executed in it
+// instead of sending them to a server.
+type recordingTx struct {
+	pgx.Tx
+	execs *[]recordedExec
+}
+
+type recordedExec struct {
+	sql  string
+	args []any
+}
+
+func (tx recordingTx) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	*tx.execs = append(*tx.execs, recordedExec{sql: sql, args: append([]any(nil), args...)})
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx recordingTx) Commit(context.Context) error   { return nil }
+func (tx recordingTx) Rollback(context.Context) error { return nil }
+
+type recordingDB struct {
+	execs []recordedExec
+}
+
+func (db *recordingDB) BeginTx(context.Context, pgx.TxOptions) (pgx.Tx, error) {
+	return recordingTx{execs: &db.execs}, nil
+}
+
+func TestMultiValuesSplitsAtBindLimit(t *testing.T) {
+	const n = 20_000
+	columns := tableColumns(false, false, false, false, 0, 0)
+	if len(columns) != 4 {
+		t.Fatalf("expected 4 columns, got %v", columns)
+	}
+	src := generatedRows{n: n, gen: func(i int) TestRow {
+		return TestRow{data: "d", description: "desc", counter1: i, counter2: i}
+	}}
+	opts := insertOptions{table: pgx.Identifier{"test_data"}, columns: columns, batchSize: n, txSize: n}
+
+	db := &recordingDB{}
+	stats, err := insertMultiValues(context.Background(), db, src.Stream(0, n), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.rows != n {
+		t.Errorf("inserted %d rows, want %d", stats.rows, n)
+	}
+	if len(db.execs) < 2 {
+		t.Errorf("%d rows of %d columns were sent in %d statements, want them split", n, len(columns), len(db.execs))
+	}
+
+	seen := make([]int, n)
+	for i, exec := range db.execs {
+		if len(exec.args) > maxBindParams {
+			t.Errorf("statement %d binds %d parameters, more than %d", i, len(exec.args), maxBindParams)
+		}
+		if len(exec.args)%len(columns) != 0 {
+			t.Fatalf("statement %d binds %d parameters, not a multiple of %d columns", i, len(exec.args), len(columns))
+		}
+		if placeholders := strings.Count(exec.sql, "$"); placeholders != len(exec.args) {
+			t.Errorf("statement %d has %d placeholders for %d parameters", i, placeholders, len(exec.args))
+		}
+		for j := 0; j < len(exec.args); j += len(columns) {
+			seen[exec.args[j+2].(int)]++
+		}
+	}
+	for i, count := range seen {
+		if count != 1 {
+			t.Errorf("row %d was inserted %d times, want once", i, count)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	driverPostgres = "postgres"
+	driverMySQL    = "mysql"
+)
+
+// Inserter is the database backend that samples write to. The workers,
+// the statistics and the output only see this interface; preparing the
+// table for a sample is still done against Postgres.
+type Inserter interface {
+	// Insert writes rows in batches of at most batchSize and reports how
+	// long that took.
+	Insert(ctx context.Context, rows rowStream, batchSize int) (insertStats, error)
+	// Clear removes every row from the table written to.
+	Clear(ctx context.Context) error
+}
+
+// pgxInserter is the Postgres backend, writing through pgx with one of the
+// insertMethods and the options it was created with.
+type pgxInserter struct {
+	pool  *pgxpool.Pool
+	write insertFunc
+	opts  insertOptions
+}
+
+func (p pgxInserter) Insert(ctx context.Context, rows rowStream, batchSize int) (insertStats, error) {
+	opts := p.opts
+	opts.batchSize = batchSize
+	return p.write(ctx, p.pool, rows, opts)
+}
+
+func (p pgxInserter) Clear(ctx context.Context) error {
+	return clearTable(ctx, p.pool, p.opts.table)
+}
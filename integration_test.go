@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// buildPscale builds the binary into a temporary directory and returns its
+// path.
+func buildPscale(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "pscale")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// runPscale runs the binary with args and returns its stdout and exit
+// status.
+func runPscale(t *testing.T, bin string, args ...string) ([]byte, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("pscale %v: %v", args, err)
+	}
+	if testing.Verbose() {
+		t.Logf("pscale %v:\n%s", args, stderr.Bytes())
+	}
+	return stdout.Bytes(), cmd.ProcessState.ExitCode()
+}
+
+func TestExitStatus(t *testing.T) {
+	bin := buildPscale(t)
+	unreachable := "-dsn=postgres://pscale@127.0.0.1:1/pscale"
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-h"}, 0},
+		{[]string{"-no-such-flag"}, exitError},
+		{[]string{"-batch-sizes=abc"}, exitError},
+		{[]string{"-format=yaml"}, exitError},
+		{[]string{"-driver=mysql"}, exitError},
+		{[]string{"no-such-command"}, exitError},
+		{[]string{"migrate"}, exitError},
+		{[]string{"migrate", "-no-such-flag", "up"}, exitError},
+		{[]string{"ping", "-count=0"}, exitError},
+		{[]string{unreachable, "-batch-sizes=10"}, exitError},
+	}
+	for _, tt := range tests {
+		if _, got := runPscale(t, bin, tt.args...); got != tt.want {
+			t.Errorf("pscale %v exited with %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestJSONOutput runs a small benchmark against the database in
+// DATABASE_URL, checking that stdout holds nothing but the JSON results and
+// that a regression against a baseline exits with exitRegression.
+func TestJSONOutput(t *testing.T) {
+	if os.Getenv("DATABASE_URL") == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	bin := buildPscale(t)
+	args := []string{"-batch-sizes=10,100", "-total-rows=1000", "-sample-size=100", "-samples=2", "-warmup=0", "-format=json"}
+
+	stdout, status := runPscale(t, bin, args...)
+	if status != 0 {
+		t.Fatalf("pscale %v exited with %d, want 0", args, status)
+	}
+	var out jsonOutput
+	if err := json.Unmarshal(stdout, &out); err != nil {
+		t.Fatalf("stdout is not valid JSON: %v\n%s", err, stdout)
+	}
+	if len(out.Results) != 2 {
+		t.Fatalf("got %d results, want one per batch size", len(out.Results))
+	}
+
+	// A baseline a hundred times faster makes every result a regression
+	for i := range out.Results {
+		out.Results[i].RowsPerSec *= 100
+	}
+	baseline, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := os.WriteFile(path, baseline, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, status = runPscale(t, bin, append(args, "-compare="+path)...)
+	if status != exitRegression {
+		t.Errorf("pscale -compare exited with %d, want %d", status, exitRegression)
+	}
+	if !json.Valid(stdout) {
+		t.Errorf("stdout under -compare is not valid JSON:\n%s", stdout)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	pkSerial = "serial"
+	pkUUID   = "uuid"
+	pkUUIDv7 = "uuidv7"
+)
+
+// uuidTable is the table created by the migrations for client-generated
+// UUID keys; it is used instead of test_data when -pk selects a UUID.
+const uuidTable = "test_data_uuid"
+
+// keyGenerators maps the UUID -pk values to their key generator.
+var keyGenerators = map[string]func() [16]byte{
+	pkUUID:   newUUIDv4,
+	pkUUIDv7: newUUIDv7,
+}
+
+// keyedByUUID is a rowSource that gives the rows of src a client-generated
+// UUID primary key. Keys are drawn fresh for every row streamed, so rows
+// that are inserted again, as in -duration runs, don't collide.
+type keyedByUUID struct {
+	src    rowSource
+	newKey func() [16]byte
+}
+
+func (k keyedByUUID) Len() int { return k.src.Len() }
+
+func (k keyedByUUID) Stream(offset, n int) rowStream {
+	return &uuidStream{rowStream: k.src.Stream(offset, n), newKey: k.newKey}
+}
+
+type uuidStream struct {
+	rowStream
+	newKey func() [16]byte
+}
+
+func (s *uuidStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	row.key = pgtype.UUID{Bytes: s.newKey(), Valid: true}
+	return row, true
+}
+
+// newUUIDv4 returns a random version 4 UUID.
+func newUUIDv4() [16]byte {
+	var u [16]byte
+	binary.BigEndian.PutUint64(u[:8], rand.Uint64())
+	binary.BigEndian.PutUint64(u[8:], rand.Uint64())
+	u[6] = u[6]&0x0f | 0x40 // Version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return u
+}
+
+// newUUIDv7 returns a version 7 UUID, whose leading 48 bits are the current
+// Unix time in milliseconds so that keys generated later sort later.
+func newUUIDv7() [16]byte {
+	u := newUUIDv4()
+	ms := uint64(time.Now().UnixMilli())
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	u[6] = u[6]&0x0f | 0x70 // Version 7
+	return u
+}
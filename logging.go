@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Exit statuses of the run command, so that scripts can tell a run that
+// failed from one that regressed.
+const (
+	exitError      = 1 // The run failed or was interrupted
+	exitRegression = 2 // A result regressed against the -compare baseline
+)
+
+// setupLogger installs the default slog logger for diagnostics, writing to
+// stderr in the given format at or above the given level.
+func setupLogger(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid -log-level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case logFormatText:
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case logFormatJSON:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("unknown -log-format %q", format)
+	}
+	return nil
+}
+
+// fatal logs msg at error level with the given attributes and exits with
+// exitError.
+func fatal(msg string, args ...any) {
+	fatalStatus(exitError, msg, args...)
+}
+
+// fatalStatus is fatal with the given exit status.
+func fatalStatus(status int, msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(status)
+}
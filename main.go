@@ -1,12 +1,22 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"math"
 	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -19,82 +29,543 @@ import (
 //go:embed migrations/*.sql
 var embedMigrations embed.FS
 
-const (
-	totalRows = 10_000_000
-)
-
-var batchSizes = []int{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000}
-
-type TestRow struct {
-	data        string
-	description string
-	counter1    int
-	counter2    int
-}
+// progress receives human-oriented progress messages. It writes to stderr
+// so that stdout only carries results, and is discarded under -quiet.
+var progress io.Writer = os.Stderr
 
 type Result struct {
-	batchSize  int
-	duration   time.Duration
-	rowsPerSec float64
-	stdDev     float64
-	samples    int
+	op          string
+	method      string
+	batchSize   int
+	txSize      int
+	workers     int
+	rows        int // Total rows inserted across all measured samples
+	duration    time.Duration
+	rowsPerSec  float64
+	stdDev      float64
+	ci95        float64 // Half-width of the 95% confidence interval of rowsPerSec
+	bootLo      float64 // Bounds of the bootstrap 95% confidence interval, see -bootstrap
+	bootHi      float64
+	minRate     float64 // Slowest sample, rows/sec
+	maxRate     float64 // Fastest sample, rows/sec
+	medianRate  float64
+	bytesPerSec float64
+	samples     int
+	rejected    int  // Outlier samples left out of rowsPerSec and stdDev
+	retries     int  // Transactions replayed after serialization failures
+	converged   bool // Whether the CV target was met before max samples
+	fixed       bool // Whether exactly -samples samples were taken, without the CV target
+	latency     latencyPercentiles
+	buckets     []latencyBucket
+	targetRate  float64            // Scheduled rows/sec under -target-rate, else 0
+	lag         latencyPercentiles // How late transactions started under -target-rate
+	startRows   []int              // Table row count at the start of each sample (-no-truncate only)
+	blobSize    int                // Bytes in the blob column of each row, see -blob-size
+	tableType   string
+	execMode    string        // pgx query exec mode, see -exec-mode
+	pipeline    int           // Statements per pipelined round-trip, see -pipeline-depth
+	server      string        // Name of the server when comparing several, see -dsn
+	indexes     int           // Secondary indexes on the table, see -secondary-indexes
+	rebuilt     bool          // Whether the indexes were dropped during the load and rebuilt after it
+	rebuild     time.Duration // Mean time to rebuild the indexes after a sample
+	rebuildRate float64       // Rows/sec including the rebuild time
+	seedRows    int           // Rows loaded before each sample, see -seed-rows
+	seeding     time.Duration // Mean time to load them
+	workerRates []float64     // Rows/sec of each worker, when there are several
+	explain     explainStats  // Mean of the batches explained, see -explain
+	allocs      allocStats    // Client allocations while inserting, see -profile-allocs
+	txTiming    txTiming      // Client and server time of the transactions, see -server-timing
+	walPerRow   float64       // Bytes of WAL written per row
+	walPerSec   float64       // Bytes of WAL written per second
+	size        tableSize     // Size of the table after the last sample
+	sizes       []int64       // Total table size after each sample (-no-truncate only)
+	order       int           // Position in the order the benchmarks ran, from 1
+	ordering    string        // How that order was chosen: "", "shuffled" or "interleaved"
+	mix         string        // Ratio of the statements under -op=mix
+	pgStats     *pgStats      // Server I/O accounting summed over the samples, see -pg-stats
+	asyncCommit bool          // Whether the transactions ran with synchronous_commit=off
+	savepoint   int           // Rows per savepoint, see -savepoint-every
+	speedup     float64       // rowsPerSec as a multiple of the smallest batch size's, see setSpeedups
+	foreignKeys int           // Foreign key columns written, see -foreign-keys
+	fkEnforced  bool          // Whether their foreign keys were checked
+	trigger     string        // BEFORE INSERT trigger fired for every row, see -trigger
+	partitions  int           // Partitions of the table, see -partitions
+	partitionBy string        // How the partitions split the table, hash or range
+	returning   bool          // Whether the inserts returned their ids, see -returning
+	crossover   bool          // Measured under -method=compare, paired with the other method
 }
 
 func main() {
-	ctx := context.Background()
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "run":
+			args = args[1:]
+		case "migrate":
+			runMigrateCommand(args[1:])
+			return
+		case "ping":
+			runPingCommand(args[1:])
+			return
+		default:
+			fatal("unknown command, expected run, migrate or ping", "command", args[0])
+		}
+	}
+	runCommand(args)
+}
+
+// runCommand benchmarks the configured batch sizes. It is the default
+// command when none is given.
+func runCommand(args []string) {
+	// Cancel the benchmark on Ctrl-C so partial results can still be reported
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := parseFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	if err := setupLogger(cfg.logFormat, cfg.logLevel); err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	if cfg.quiet {
+		progress = io.Discard
+	} else {
+		status = newStatusLine(os.Stderr)
+		progress = status
+	}
+
+	// Load the baseline first so that a bad path fails before the run
+	var baseline []jsonResult
+	if cfg.compare != "" {
+		if baseline, err = loadBaseline(cfg.compare); err != nil {
+			fatal("failed to load baseline", "err", err)
+		}
+	}
 
 	// Load .env file if it exists (not fatal if missing)
 	_ = godotenv.Load()
 
-	// Get database connection string from environment
-	connString := os.Getenv("DATABASE_URL")
-	if connString == "" {
-		log.Fatal("DATABASE_URL environment variable is required")
+	// Get the database connection strings from the flag or environment
+	dsns := cfg.dsns
+	if len(dsns) == 0 {
+		dsns = []string{""}
+	}
+	connStrings := make([]string, len(dsns))
+	for i, dsn := range dsns {
+		if connStrings[i], err = resolveDSN(dsn); err != nil {
+			fatal("invalid configuration", "err", err)
+		}
 	}
 
-	// Connect to database
-	pool, err := pgxpool.New(ctx, connString)
+	src, err := newRowSource(cfg)
 	if err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
+		fatal("invalid configuration", "err", err)
 	}
-	defer pool.Close()
+	if cfg.printConfig {
+		displayConfig(os.Stdout, cfg, connStrings)
+		return
+	}
+	if cfg.dryRun {
+		displayPlan(os.Stdout, cfg, src)
+		return
+	}
+	displayConfig(progress, cfg, connStrings)
 
-	// Run migrations
-	if err := runMigrations(connString); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	if cfg.stream {
+		stream = newSampleStream(os.Stdout)
 	}
 
-	fmt.Println("Generating test data...")
-	data := generateData(totalRows)
-	fmt.Printf("Generated %d rows\n\n", len(data))
+	stopMetrics := func() {}
+	if cfg.metricsAddr != "" {
+		metrics = newBenchMetrics()
+		stopMetrics, err = serveMetrics(cfg.metricsAddr)
+		if err != nil {
+			fatal("failed to start metrics server", "err", err)
+		}
+	}
+	defer stopMetrics()
 
-	// Run benchmarks for each batch size
+	// Profile the measurements only, though with several servers this
+	// includes preparing the later ones
+	stopProfiling, err := startProfiling(cfg.cpuProfile, cfg.memProfile)
+	if err != nil {
+		fatal("failed to start profiling", "err", err)
+	}
+
+	// Run the full suite against each server in turn
+	info := runInfo{started: time.Now(), runMetadata: collectMetadata(cfg.label)}
 	var results []Result
-	for _, batchSize := range batchSizes {
-		fmt.Printf("Testing batch size: %d\n", batchSize)
+	for _, connString := range connStrings {
+		name := ""
+		if len(connStrings) > 1 {
+			name = serverName(connString, len(info.servers))
+		}
+		server, serverResults, runErr := benchmarkServer(ctx, cfg, connString, name, src)
+		results = append(results, serverResults...)
+		if server.serverVersion != "" {
+			info.servers = append(info.servers, server)
+		}
+		if err = runErr; err != nil {
+			if name != "" {
+				err = fmt.Errorf("%s: %w", name, err)
+			}
+			break
+		}
+	}
+	if err := stopProfiling(); err != nil {
+		fatal("failed to write profile", "err", err)
+	}
+	interrupted := err != nil && ctx.Err() != nil
+	if err != nil && !interrupted {
+		fatal("benchmark failed", "err", err)
+	}
+	if interrupted {
+		fmt.Fprintf(progress, "\nInterrupted, reporting %d completed batch sizes\n\n", len(results))
+	}
+	setSpeedups(results)
+	info.elapsed, info.phases = time.Since(info.started), phases
+
+	if err := writeOutput(cfg, info, results); err != nil {
+		fatal("failed to write results", "err", err)
+	}
+	if cfg.save != "" {
+		if err := saveBaseline(cfg.save, info, results); err != nil {
+			fatal("failed to save baseline", "err", err)
+		}
+	}
+	if baseline != nil {
+		// Keep stdout parseable when it carries machine-readable results
+		var w io.Writer = os.Stdout
+		if cfg.format != formatText || cfg.output != "" {
+			w = os.Stderr
+		}
+		comparisons := compareResults(baseline, results, cfg.regressionThreshold)
+		displayComparison(w, cfg.compare, comparisons)
+		regressions := 0
+		for _, c := range comparisons {
+			if c.regressed {
+				regressions++
+			}
+		}
+		if regressions > 0 {
+			stopMetrics()
+			fatalStatus(exitRegression, "throughput regressed against baseline", "baseline", cfg.compare, "regressions", regressions)
+		}
+	}
+	if interrupted {
+		stopMetrics()
+		os.Exit(exitError)
+	}
+}
+
+// serverName labels the server at connString in results comparing several
+// servers by its address and database. The ith server is numbered when
+// the connection string can't be parsed.
+func serverName(connString string, i int) string {
+	cc, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return fmt.Sprintf("server %d", i+1)
+	}
+	return fmt.Sprintf("%s:%d/%s", cc.Host, cc.Port, cc.Database)
+}
+
+// benchmarkServer connects to the server at connString, prepares its table
+// and runs the benchmarks against it, labelling the results with name. The
+// returned serverInfo is empty if the server couldn't be queried.
+func benchmarkServer(ctx context.Context, cfg config, connString, name string, src rowSource) (serverInfo, []Result, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return serverInfo{}, nil, fmt.Errorf("invalid connection string: %w", err)
+	}
+	poolConfig.ConnConfig.DefaultQueryExecMode = execModes[cfg.execMode]
+	if cfg.maxConns > 0 {
+		poolConfig.MaxConns = int32(cfg.maxConns)
+	}
+	if cfg.minConns > 0 {
+		poolConfig.MinConns = int32(cfg.minConns)
+	}
+	// Each worker holds a connection for the whole of its transactions
+	if cfg.tableType == tableTemp {
+		// A temporary table only exists in the session that created it
+		poolConfig.MaxConns, poolConfig.MinConns = 1, 0
+	}
+	if workers := slices.Max(cfg.workerCounts); workers > int(poolConfig.MaxConns) {
+		return serverInfo{}, nil, fmt.Errorf("workers (%d) exceed the pool's max connections (%d)", workers, poolConfig.MaxConns)
+	}
+	slog.Info("connection pool", "server", name, "max_conns", poolConfig.MaxConns, "min_conns", poolConfig.MinConns)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return serverInfo{}, nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+	defer pool.Close()
+
+	// Run migrations, or only check that the table is there when the
+	// schema is managed elsewhere
+	table := cfg.tableIdentifier()
+	if cfg.skipMigrations {
+		if cfg.autoCreate {
+			if err := createTable(ctx, pool, table, cfg.pk == pkSerial); err != nil {
+				return serverInfo{}, nil, fmt.Errorf("failed to create table: %w", err)
+			}
+			if err := addExtraColumns(ctx, pool, table, cfg.columns); err != nil {
+				return serverInfo{}, nil, fmt.Errorf("failed to add extra columns: %w", err)
+			}
+		}
+		if err := checkTable(ctx, pool, table, cfg.tableColumns()); err != nil {
+			return serverInfo{}, nil, fmt.Errorf("table %s is not usable: %w", cfg.table, err)
+		}
+	} else {
+		if err := runMigrations(connString, "up"); err != nil {
+			return serverInfo{}, nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+		if err := addExtraColumns(ctx, pool, table, cfg.columns); err != nil {
+			return serverInfo{}, nil, fmt.Errorf("failed to add extra columns: %w", err)
+		}
+		if cfg.foreignKeys > 0 {
+			if err := setupForeignKeys(ctx, pool, table, cfg.foreignKeys); err != nil {
+				return serverInfo{}, nil, err
+			}
+		}
+		if err := setForeignKeys(ctx, pool, table, 0, false); err != nil {
+			return serverInfo{}, nil, fmt.Errorf("failed to drop foreign keys: %w", err)
+		}
+		if err := setTrigger(ctx, pool, table, triggerNone); err != nil {
+			return serverInfo{}, nil, err
+		}
+	}
 
-		// Run warmup transactions
-		if err := runWarmup(ctx, pool, data, batchSize); err != nil {
-			log.Fatalf("Failed to run warmup: %v", err)
+	if cfg.cleanup != cleanupNone {
+		defer cleanUp(context.WithoutCancel(ctx), pool, cfg)
+	}
+
+	if err := applyTableType(ctx, pool, table, cfg.tableType); err != nil {
+		return serverInfo{}, nil, fmt.Errorf("failed to set table type: %w", err)
+	}
+	if err := dropSecondaryIndexes(ctx, pool, table); err != nil {
+		return serverInfo{}, nil, fmt.Errorf("failed to drop secondary indexes: %w", err)
+	}
+	if err := createSecondaryIndexes(ctx, pool, table, cfg.tableColumns(), cfg.secondaryIndexes); err != nil {
+		return serverInfo{}, nil, fmt.Errorf("failed to create secondary indexes: %w", err)
+	}
+	if cfg.partitions > 0 {
+		// Enough range partitions to take the keys of every sample
+		rows := min(cfg.sampleSize, cfg.totalRows) + cfg.seedRows
+		if cfg.op != opInsert {
+			rows = max(rows, cfg.prepopulateRows)
+		}
+		part := pgx.Identifier(strings.Split(partitionedTable(cfg.table), "."))
+		if err := createPartitionedTable(ctx, pool, table, part, cfg.partitionBy, cfg.partitions, cfg.pk == pkSerial, rows); err != nil {
+			return serverInfo{}, nil, err
+		}
+	}
+	if slices.Contains(cfg.methods, methodUpsert) {
+		if err := checkUniqueKey(ctx, pool, table); err != nil {
+			return serverInfo{}, nil, fmt.Errorf("table %s is not usable for upsert: %w", cfg.table, err)
+		}
+	}
+
+	server := serverInfo{name: name, host: poolConfig.ConnConfig.Host}
+	var encrypted bool
+	if server.transport, encrypted, err = connTransport(ctx, pool); err != nil {
+		return serverInfo{}, nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+	if cfg.requireTLS && !encrypted {
+		return serverInfo{}, nil, fmt.Errorf("-require-tls is set but the connection to %s is not encrypted (%s)", poolConfig.ConnConfig.Host, server.transport)
+	}
+	if server.serverVersion, server.settings, err = querySettings(ctx, pool); err != nil {
+		return serverInfo{}, nil, fmt.Errorf("failed to query server settings: %w", err)
+	}
+	logServer(server)
+	displayServer(progress, server)
+	if cfg.overhead > 0 {
+		// The round-trip overhead is measured with the commits the server is
+		// configured for, even when -async-commit also runs without them
+		syncCfg := cfg
+		syncCfg.asyncCommit = false
+		if server.overhead, err = measureOverhead(ctx, pool, syncCfg.txOptions(), cfg.overhead); err != nil {
+			return server, nil, fmt.Errorf("failed to measure overhead: %w", err)
 		}
+	}
+
+	if cfg.pgStats {
+		cfg.pgStatements = hasStatementStats(ctx, pool)
+	}
+
+	fmt.Fprintf(progress, "Streaming up to %d rows\n\n", src.Len())
+	results, err := runBenchmarks(ctx, pool, src, cfg)
+	for i := range results {
+		results[i].server = name
+	}
+	return server, results, err
+}
 
-		// Measure steady-state performance
-		result, err := measureSteadyState(ctx, pool, data, batchSize)
+// newRowSource returns the rows described by cfg. They are generated, or
+// read from -csv-input, on demand as the inserts consume them.
+func newRowSource(cfg config) (rowSource, error) {
+	var src rowSource
+	if cfg.csvInput != "" {
+		rows, err := openCSVRows(cfg.csvInput, cfg.totalRows, cfg.csvLoop)
 		if err != nil {
-			log.Fatalf("Failed to measure steady state: %v", err)
+			return nil, err
 		}
+		src = rows
+	} else if cfg.randomData {
+		src = generateRandomData(cfg.totalRows, cfg.rowSize, cfg.compressibility, cfg.seed)
+	} else {
+		src = generateData(cfg.totalRows)
+	}
+	if newKey, ok := keyGenerators[cfg.pk]; ok {
+		src = keyedByUUID{src: src, newKey: newKey}
+	}
+	if cfg.payloadKeys > 0 {
+		src = payloadRows{src: src, keys: cfg.payloadKeys}
+	}
+	if cfg.blobSize > 0 {
+		src = blobRows{src: src, size: cfg.blobSize, seed: cfg.seed}
+	}
+	if cfg.arrayLen > 0 {
+		src = arrayRows{src: src, n: cfg.arrayLen}
+	}
+	if cfg.columns > 0 {
+		src = widenedRows{src: src, n: cfg.columns}
+	}
+	if cfg.foreignKeys > 0 {
+		src = referencingRows{src: src, n: cfg.foreignKeys}
+	}
+	if cfg.nullRate > 0 {
+		src = nullRows{src: src, rate: cfg.nullRate}
+	}
+	return src, nil
+}
 
+// runBenchmarks measures every combination from benchmarkRuns in turn, or
+// a sample of each at a time with -interleave. On error it returns the
+// results collected so far alongside the error.
+func runBenchmarks(ctx context.Context, pool *pgxpool.Pool, src rowSource, cfg config) ([]Result, error) {
+	runs := benchmarkRuns(cfg)
+	if cfg.interleave {
+		return runInterleaved(ctx, pool, src, runs)
+	}
+	var results []Result
+	for i, run := range runs {
+		result, err := runBenchmark(ctx, pool, src, run.cfg, run.batchSize)
+		if err != nil {
+			return results, err
+		}
+		result.order = i + 1
+		if cfg.shuffle {
+			result.ordering = orderShuffled
+		}
 		results = append(results, result)
+	}
+	return results, nil
+}
 
-		fmt.Printf("  Throughput: %.0f ± %.0f rows/sec (%d samples)\n\n",
-			result.rowsPerSec, result.stdDev, result.samples)
+// runLabel describes the benchmark of batchSize with cfg in the progress
+// output.
+func runLabel(cfg config, batchSize int) string {
+	txSize := cfg.txSizeFor(batchSize)
+	label := fmt.Sprintf("Testing batch size: %d", batchSize)
+	if txSize != batchSize {
+		label += fmt.Sprintf(" (transaction size: %d)", txSize)
+	}
+	if len(cfg.methods) > 1 {
+		label += fmt.Sprintf(" using %s", cfg.method)
+	}
+	if len(cfg.workerCounts) > 1 {
+		label += fmt.Sprintf(" with %d workers", cfg.workers)
+	}
+	if cfg.rebuildIndexes {
+		label += ", rebuilding indexes after the load"
+	}
+	if cfg.asyncCommit {
+		label += ", with synchronous_commit=off"
+	}
+	if cfg.savepointEvery > 0 {
+		label += fmt.Sprintf(", with a savepoint every %d rows", cfg.savepointEvery)
+	}
+	if cfg.enforceForeignKeys {
+		label += ", checking foreign keys"
 	}
+	if cfg.trigger != triggerNone {
+		label += fmt.Sprintf(", with a %s trigger", cfg.trigger)
+	}
+	if cfg.partitions > 0 {
+		label += fmt.Sprintf(", into %d %s partitions", cfg.partitions, cfg.partitionBy)
+	}
+	if cfg.returning {
+		label += ", returning ids"
+	}
+	return label
+}
 
-	// Display histogram
-	displayHistogram(results)
+// warmUp runs the -warmup transactions before batchSize is measured.
+func warmUp(ctx context.Context, pool *pgxpool.Pool, src rowSource, cfg config, batchSize int) error {
+	if cfg.warmup == 0 {
+		return nil
+	}
+	defer addSince(&phases.warmup, time.Now())
+	if err := runWarmup(ctx, pool, cfg.warmupInsert(), src, cfg.insertOptions(batchSize), cfg.warmup, cfg.warmupSizeFor(batchSize)); err != nil {
+		return fmt.Errorf("failed to run warmup: %w", err)
+	}
+	return nil
 }
 
-func runMigrations(connString string) error {
+// runBenchmark warms up and measures a single batch size with the method
+// and worker count in cfg.
+func runBenchmark(ctx context.Context, pool *pgxpool.Pool, src rowSource, cfg config, batchSize int) (Result, error) {
+	fmt.Fprintln(progress, runLabel(cfg, batchSize))
+	if cfg.foreignKeys > 0 {
+		if err := setForeignKeys(ctx, pool, cfg.tableIdentifier(), cfg.foreignKeys, cfg.enforceForeignKeys); err != nil {
+			return Result{}, err
+		}
+	}
+	if cfg.trigger != triggerNone {
+		if err := setTrigger(ctx, pool, cfg.tableIdentifier(), cfg.trigger); err != nil {
+			return Result{}, err
+		}
+		// A trigger left behind by an interrupted run is dropped when the
+		// next one sets up the table
+		defer setTrigger(ctx, pool, cfg.tableIdentifier(), triggerNone)
+	}
+	if err := warmUp(ctx, pool, src, cfg, batchSize); err != nil {
+		return Result{}, err
+	}
+
+	// Measure steady-state performance, or run for a fixed time
+	var result Result
+	var err error
+	if cfg.duration > 0 {
+		result, err = measureForDuration(ctx, pool, src, cfg, batchSize)
+	} else {
+		result, err = measureSteadyState(ctx, pool, src, cfg, batchSize)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to measure steady state: %w", err)
+	}
+	reportThroughput(result)
+	stream.summary(result)
+	return result, nil
+}
+
+// reportThroughput prints the outcome of a benchmark to progress.
+func reportThroughput(result Result) {
+	if result.blobSize > 0 {
+		fmt.Fprintf(progress, "  Throughput: %.1f MB/sec, %.0f ± %.0f rows/sec (%d samples)\n\n",
+			result.bytesPerSec/1e6, result.rowsPerSec, result.stdDev, result.samples)
+	} else {
+		fmt.Fprintf(progress, "  Throughput: %.0f ± %.0f rows/sec (%d samples)\n\n",
+			result.rowsPerSec, result.stdDev, result.samples)
+	}
+}
+
+// runMigrations applies a goose action to the embedded migrations: up,
+// down, status or reset.
+func runMigrations(connString, action string) error {
 	goose.SetBaseFS(embedMigrations)
 
 	db, err := goose.OpenDBWithDriver("pgx", connString)
@@ -103,223 +574,1246 @@ func runMigrations(connString string) error {
 	}
 	defer db.Close()
 
-	if err := goose.Up(db, "migrations"); err != nil {
+	switch action {
+	case "up":
+		err = goose.Up(db, "migrations")
+	case "down":
+		err = goose.Down(db, "migrations")
+	case "status":
+		err = goose.Status(db, "migrations")
+	case "reset":
+		err = goose.Reset(db, "migrations")
+	default:
+		return fmt.Errorf("unknown migrate action %q: expected up, down, status or reset", action)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
 	return nil
 }
 
-func generateData(n int) []TestRow {
-	data := make([]TestRow, n)
-	for i := 0; i < n; i++ {
-		data[i] = TestRow{
-			data:        fmt.Sprintf("test data row %d", i),
-			description: fmt.Sprintf("description for row %d with some additional text to make it more realistic", i),
-			counter1:    i * 2,
-			counter2:    i * 3,
-		}
+// runMigrateCommand implements "pscale migrate [-dsn=...] up|down|status|reset".
+func runMigrateCommand(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dsn := fs.String("dsn", "", "database connection string (overrides DATABASE_URL)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pscale migrate [-dsn=...] up|down|status|reset")
+		fs.PrintDefaults()
+	}
+	parseCommandFlags(fs, args, func() bool { return fs.NArg() == 1 })
+
+	_ = godotenv.Load()
+	connString, err := resolveDSN(*dsn)
+	if err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	if err := runMigrations(connString, fs.Arg(0)); err != nil {
+		fatal("migration failed", "action", fs.Arg(0), "err", err)
 	}
-	return data
 }
 
-func clearTable(ctx context.Context, pool *pgxpool.Pool) error {
-	_, err := pool.Exec(ctx, "TRUNCATE test_data")
+// parseCommandFlags parses the flags of a subcommand from args into fs,
+// which must return its errors, and checks them with valid. It exits with
+// status 0 after -h, and with exitError after printing the usage when the
+// flags are invalid.
+func parseCommandFlags(fs *flag.FlagSet, args []string, valid func() bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		// fs has printed the error and the usage
+		os.Exit(exitError)
+	}
+	if !valid() {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+}
+
+// validateRowCount checks that table holds exactly want rows.
+func validateRowCount(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, want int) error {
+	var got int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+table.Sanitize()).Scan(&got); err != nil {
+		return fmt.Errorf("failed to count rows: %w", err)
+	}
+	if got != want {
+		return fmt.Errorf("validation failed: %s holds %d rows, expected %d", table.Sanitize(), got, want)
+	}
+	return nil
+}
+
+// checkTable verifies that table exists and has an id and the given
+// columns.
+func checkTable(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, columns []string) error {
+	if !slices.Contains(columns, "id") {
+		columns = append([]string{"id"}, columns...)
+	}
+	_, err := pool.Exec(ctx, "SELECT "+columnList(columns)+" FROM "+table.Sanitize()+" LIMIT 0")
 	return err
 }
 
-func insertWithBatch(ctx context.Context, pool *pgxpool.Pool, data []TestRow, batchSize int) (time.Duration, error) {
-	start := time.Now()
+// createTable creates table with the columns the migrations give the
+// test tables, keyed by a serial or a UUID id, unless a table of that name
+// already exists. It is for -auto-create, which leaves goose out.
+func createTable(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, serial bool) error {
+	id := "UUID"
+	if serial {
+		id = "BIGSERIAL"
+	}
+	_, err := pool.Exec(ctx, "CREATE TABLE IF NOT EXISTS "+table.Sanitize()+` (
+		id `+id+` PRIMARY KEY,
+		data TEXT NOT NULL,
+		description TEXT,
+		counter1 INTEGER NOT NULL,
+		counter2 INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		payload JSONB,
+		numbers INTEGER[],
+		blob BYTEA,
+		updated_at TIMESTAMP
+	)`)
+	return err
+}
 
-	// Process data in transactions of batchSize rows each
-	for i := 0; i < len(data); i += batchSize {
-		end := i + batchSize
-		if end > len(data) {
-			end = len(data)
+// addExtraColumns adds the text columns extra_1 to extra_<n> to table,
+// which the migration can't do since their number is only known at run
+// time. Columns left over from earlier, wider runs are kept.
+func addExtraColumns(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, n int) error {
+	if n == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("ALTER TABLE " + table.Sanitize())
+	for i, c := range tableColumns(false, false, false, false, n, 0)[len(testDataColumns):] {
+		if i > 0 {
+			b.WriteByte(',')
 		}
+		b.WriteString(" ADD COLUMN IF NOT EXISTS " + pgx.Identifier{c}.Sanitize() + " TEXT")
+	}
+	_, err := pool.Exec(ctx, b.String())
+	return err
+}
 
-		// Create a new transaction for this batch
-		tx, err := pool.Begin(ctx)
+// cleanUp empties or drops the benchmark table after the run, as chosen by
+// -cleanup, along with the -partitions table and, when dropping, the
+// -foreign-keys parent table. Errors are only logged, so as not to hide
+// the run's own.
+func cleanUp(ctx context.Context, pool *pgxpool.Pool, cfg config) {
+	tables := []pgx.Identifier{cfg.tableIdentifier()}
+	if cfg.partitions > 0 {
+		tables = append(tables, pgx.Identifier(strings.Split(partitionedTable(cfg.table), ".")))
+	}
+	if cfg.cleanup == cleanupDrop && cfg.foreignKeys > 0 {
+		tables = append(tables, parentTable(cfg.tableIdentifier()))
+	}
+	for _, table := range tables {
+		var err error
+		if cfg.cleanup == cleanupDrop {
+			_, err = pool.Exec(ctx, "DROP TABLE IF EXISTS "+table.Sanitize()+" CASCADE")
+		} else {
+			err = clearTable(ctx, pool, table)
+		}
 		if err != nil {
-			return 0, err
+			slog.Warn("failed to clean up", "table", table.Sanitize(), "cleanup", cfg.cleanup, "err", err)
+			continue
 		}
+		slog.Info("cleaned up", "table", table.Sanitize(), "cleanup", cfg.cleanup)
+	}
+}
+
+// clearTable empties table, restarting the sequence of its serial key so
+// that every sample writes the same keys: -partition-by=range depends on
+// it.
+func clearTable(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier) error {
+	_, err := pool.Exec(ctx, "TRUNCATE "+table.Sanitize()+" RESTART IDENTITY")
+	return err
+}
 
-		// Use pgx.Batch for efficient pipelining within the transaction
-		batch := &pgx.Batch{}
-		for _, row := range data[i:end] {
-			batch.Queue("INSERT INTO test_data (data, description, counter1, counter2) VALUES ($1, $2, $3, $4)",
-				row.data, row.description, row.counter1, row.counter2)
+// runWarmup runs warmup transactions to ensure database is in steady state,
+// each inserting warmupSize rows with insert.
+func runWarmup(ctx context.Context, pool *pgxpool.Pool, insert insertFunc, src rowSource, opts insertOptions, iterations, warmupSize int) error {
+	fmt.Fprintf(progress, "  Running %d warmup transactions...\n", iterations)
+
+	// Use a small subset of data for warmup
+	warmupSize = min(warmupSize, src.Len())
+	opts.txSize = warmupSize
+	ins := pgxInserter{pool: pool, write: insert, opts: opts}
+
+	for i := 0; i < iterations; i++ {
+		if _, err := insertRows(ctx, ins, src, 0, warmupSize, opts.batchSize); err != nil {
+			return err
 		}
+	}
+
+	// Clear the warmup data
+	if err := ins.Clear(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
 
-		br := tx.SendBatch(ctx, batch)
-		if err := br.Close(); err != nil {
-			tx.Rollback(ctx)
-			return 0, err
+// coolDown pauses between samples for d, first running VACUUM on table
+// when vacuum is set. A vacuum that outlasts d isn't cut short.
+func coolDown(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, d time.Duration, vacuum bool) error {
+	start := time.Now()
+	defer addSince(&phases.cooldown, start)
+	if vacuum {
+		if _, err := pool.Exec(ctx, "VACUUM "+table.Sanitize()); err != nil {
+			return fmt.Errorf("failed to vacuum: %w", err)
 		}
+	}
+	return sleepContext(ctx, d-time.Since(start))
+}
+
+// measureSteadyState runs the benchmark until performance stabilizes
+func measureSteadyState(ctx context.Context, pool *pgxpool.Pool, src rowSource, cfg config, batchSize int) (Result, error) {
+	s, err := newSteadyState(pool, src, cfg, batchSize)
+	if err != nil {
+		return Result{}, err
+	}
 
-		if err := tx.Commit(ctx); err != nil {
-			return 0, err
+	// At most maxSamples samples are run, which bounds the ETA
+	stopProgress := trackProgress(cfg.maxSamples*s.rowsPerSample(), time.Time{})
+	defer stopProgress()
+
+	for !s.done {
+		if err := s.sample(ctx); err != nil {
+			return Result{}, err
 		}
 	}
+	return s.result(), nil
+}
+
+// steadyState is a benchmark measured one sample at a time until the CV
+// target or cfg.maxSamples is reached. measureSteadyState runs its samples
+// back to back; -interleave takes turns between several.
+type steadyState struct {
+	pool      *pgxpool.Pool
+	ins       Inserter // Writes the samples, with op.write
+	src       rowSource
+	cfg       config
+	batchSize int
+	opts      insertOptions
+	op        operation
+
+	durations  []float64
+	bandwidths []float64
+	latencies  []time.Duration
+	startRows  []int
+	totalRows  int
+	retries    int
+	running    runningStats
+	explained  explainStats
+	allocs     allocStats
+	txTiming   txTiming
+	walRates   []float64
+	walBytes   int64
+	size       tableSize
+	sizes      []int64
+	workers    []workerStats
+	elapsed    time.Duration
+	rebuild    time.Duration
+	seeding    time.Duration
+	seeds      int
+	seedSum    *uint64 // Checksum of the -seed-rows, once computed
+	timeouts   int     // Samples aborted by -sample-timeout
+	pgStats    pgStats
+	converged  bool
+	done       bool // Whether the samples have converged or run out
+}
+
+func newSteadyState(pool *pgxpool.Pool, src rowSource, cfg config, batchSize int) (*steadyState, error) {
+	opts := cfg.insertOptions(batchSize)
+	op, err := newOperation(pool, src, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	ins := pgxInserter{pool: pool, write: op.write, opts: opts}
+	return &steadyState{pool: pool, ins: ins, src: src, cfg: cfg, batchSize: batchSize, opts: opts, op: op}, nil
+}
 
-	return time.Since(start), nil
+// rowsPerSample returns the rows written by each sample.
+func (s *steadyState) rowsPerSample() int {
+	return min(s.cfg.sampleSize, s.src.Len())
 }
 
-// runWarmup runs warmup transactions to ensure database is in steady state
-func runWarmup(ctx context.Context, pool *pgxpool.Pool, data []TestRow, batchSize int) error {
-	fmt.Println("  Running warmup transactions...")
-	for i := 0; i < 2; i++ {
-		// Use a small subset of data for warmup
-		warmupSize := batchSize
-		if warmupSize > len(data) {
-			warmupSize = len(data)
+// maxSampleTimeouts is the number of samples of one benchmark that
+// -sample-timeout aborts and retries before the benchmark fails.
+const maxSampleTimeouts = 3
+
+// errSampleTimeout reports a sample aborted by -sample-timeout that is to
+// be retried.
+var errSampleTimeout = errors.New("sample timed out")
+
+// insert writes the rows of the next sample, aborting them once
+// -sample-timeout passes. The aborted transactions are rolled back, and
+// the sample is retried by returning errSampleTimeout until
+// maxSampleTimeouts have been aborted.
+func (s *steadyState) insert(ctx context.Context, setup sampleSetup, n int) (insertStats, error) {
+	if s.cfg.sampleTimeout == 0 {
+		return insertConcurrently(ctx, s.ins, setup.src, setup.offset, n, s.opts, s.cfg.workers)
+	}
+	sampleCtx, cancel := context.WithTimeout(ctx, s.cfg.sampleTimeout)
+	defer cancel()
+	stats, err := insertConcurrently(sampleCtx, s.ins, setup.src, setup.offset, n, s.opts, s.cfg.workers)
+	if err == nil || ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+		return stats, err
+	}
+	s.timeouts++
+	err = fmt.Errorf("sample %d timed out after %v: %w", len(s.durations)+1, s.cfg.sampleTimeout, err)
+	if s.timeouts > maxSampleTimeouts {
+		return insertStats{}, err
+	}
+	slog.Warn("retrying sample", "err", err)
+	return insertStats{}, errSampleTimeout
+}
+
+// sample runs and records the next sample, then sets s.done once the
+// samples have converged or cfg.maxSamples have run.
+func (s *steadyState) sample(ctx context.Context) error {
+	pool, cfg, opts := s.pool, s.cfg, s.opts
+	if len(s.durations) > 0 {
+		if err := coolDown(ctx, pool, opts.table, cfg.cooldown, cfg.vacuumBetween); err != nil {
+			return err
 		}
+	}
 
-		tx, err := pool.Begin(ctx)
+	// Determine how many rows to insert for this sample
+	rowsToInsert := s.rowsPerSample()
+
+	start := time.Now()
+	setup, err := s.op.prepare(ctx, len(s.durations), rowsToInsert)
+	addSince(&phases.prepare, start)
+	if err != nil {
+		return err
+	}
+	if cfg.noTruncate {
+		s.startRows = append(s.startRows, s.totalRows)
+	}
+	if setup.seeding > 0 {
+		s.seeding += setup.seeding
+		s.seeds++
+	}
+
+	if cfg.rebuildIndexes {
+		if err := dropSecondaryIndexes(ctx, pool, opts.table); err != nil {
+			return err
+		}
+	}
+
+	// Measure this sample
+	lsn, err := currentWALLSN(ctx, pool)
+	if err != nil {
+		return err
+	}
+	var before pgStats
+	if cfg.pgStats {
+		if before, err = readPGStats(ctx, pool, opts.table, cfg.pgStatements); err != nil {
+			return err
+		}
+	}
+	var mem runtime.MemStats
+	if cfg.profileAllocs {
+		runtime.ReadMemStats(&mem)
+	}
+	start = time.Now()
+	stats, err := s.insert(ctx, setup, rowsToInsert)
+	addSince(&phases.measuring, start)
+	if errors.Is(err, errSampleTimeout) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if cfg.profileAllocs {
+		s.allocs.add(&mem, stats.rows)
+	}
+	if cfg.serverTiming {
+		var t txTiming
+		t.add(stats)
+		s.txTiming.add(stats)
+		fmt.Fprintf(progress, "    Server time %.1f%% of transactions, network + client overhead %v per transaction\n",
+			t.serverShare()*100, t.overheadPerTx().Round(time.Microsecond))
+	}
+	if cfg.pgStats {
+		after, err := readPGStats(ctx, pool, opts.table, cfg.pgStatements)
+		if err != nil {
+			return err
+		}
+		s.pgStats.add(after.sub(before))
+	}
+	wal, err := walSince(ctx, pool, lsn)
+	if err != nil {
+		return err
+	}
+	s.walBytes += wal
+	s.walRates = append(s.walRates, float64(wal)/stats.elapsed.Seconds())
+	s.elapsed += stats.elapsed
+	if cfg.explain {
+		es, err := explainBatch(ctx, pool, setup.src, setup.offset, opts)
 		if err != nil {
 			return err
 		}
+		s.explained.add(es)
+	}
+	if cfg.rebuildIndexes {
+		took, err := rebuildIndexes(ctx, pool, cfg)
+		if err != nil {
+			return err
+		}
+		s.rebuild += took
+	}
+	rowsAfter := setup.rowsBefore + s.op.rowDelta(rowsToInsert) - setup.conflicts
+	if cfg.validateRows {
+		if err := validateRowCount(ctx, pool, opts.table, rowsAfter); err != nil {
+			return err
+		}
+	}
+	if cfg.checksum {
+		if err := s.validateChecksum(ctx, setup, rowsToInsert); err != nil {
+			return err
+		}
+	}
+	if s.size, err = measureTableSize(ctx, pool, opts.table, rowsAfter); err != nil {
+		return err
+	}
+	if cfg.noTruncate {
+		s.sizes = append(s.sizes, s.size.total)
+	}
+
+	rowsPerSec := float64(stats.rows) / stats.elapsed.Seconds()
+	s.bandwidths = append(s.bandwidths, float64(stats.bytes)/stats.elapsed.Seconds())
+	s.latencies = append(s.latencies, stats.latencies...)
+	s.durations = append(s.durations, rowsPerSec)
+	s.running.add(rowsPerSec)
+	s.workers = addWorkerStats(s.workers, stats.workers)
+	metrics.observeSample(stats, rowsPerSec)
+	stream.sample(cfg, s.batchSize, len(s.durations), rowsPerSec, s.running)
+	s.totalRows += rowsToInsert
+	s.retries += stats.retries
+
+	// Check if we've reached steady state
+	if len(s.durations) >= cfg.minSamples {
+		// Rejecting outliers needs all samples, otherwise the running
+		// statistics answer the gate without going over them again
+		kept := s.durations
+		mean, stdDev := s.running.mean, s.running.stdDev()
+		if cfg.rejectOutliers {
+			kept = cfg.keptSamples(s.durations)
+			mean = calculateMean(kept)
+			stdDev = calculateStdDev(kept, mean)
+		}
+		cv := stdDev / mean
 
-		batch := &pgx.Batch{}
-		for j := 0; j < warmupSize; j++ {
-			row := data[j]
-			batch.Queue("INSERT INTO test_data (data, description, counter1, counter2) VALUES ($1, $2, $3, $4)",
-				row.data, row.description, row.counter1, row.counter2)
+		if rejected := len(s.durations) - len(kept); rejected > 0 {
+			fmt.Fprintf(progress, "    Sample %d: %.0f rows/sec (mean: %.0f, CV: %.2f%%, %d outliers rejected)\n",
+				len(s.durations), rowsPerSec, mean, cv*100, rejected)
+		} else {
+			fmt.Fprintf(progress, "    Sample %d: %.0f rows/sec (mean: %.0f, CV: %.2f%%)\n",
+				len(s.durations), rowsPerSec, mean, cv*100)
 		}
 
-		br := tx.SendBatch(ctx, batch)
-		if err := br.Close(); err != nil {
-			tx.Rollback(ctx)
-			return err
+		if cv <= cfg.targetCV && cfg.samples == 0 {
+			fmt.Fprintf(progress, "  Reached steady state after %d samples (CV: %.2f%%)\n", len(s.durations), cv*100)
+			s.converged = true
+			s.done = true
+			return nil
+		}
+	} else {
+		fmt.Fprintf(progress, "    Sample %d: %.0f rows/sec\n", len(s.durations), rowsPerSec)
+	}
+	if len(s.durations) == cfg.maxSamples {
+		// Reached max samples without stabilizing, or the fixed count
+		kept := cfg.keptSamples(s.durations)
+		mean := calculateMean(kept)
+		cv := calculateStdDev(kept, mean) / mean * 100
+		if cfg.samples > 0 {
+			fmt.Fprintf(progress, "  Took the fixed %d samples with CV: %.2f%%\n", cfg.samples, cv)
+			s.converged = true
+		} else {
+			fmt.Fprintf(progress, "  Reached max samples (%d) with CV: %.2f%%\n", cfg.maxSamples, cv)
 		}
+		s.done = true
+	}
+	return nil
+}
 
-		if err := tx.Commit(ctx); err != nil {
+// validateChecksum checks that the table holds the -seed-rows and the n
+// rows the sample wrote, and nothing else.
+func (s *steadyState) validateChecksum(ctx context.Context, setup sampleSetup, n int) error {
+	if s.seedSum == nil {
+		sum, err := checksumRows(s.src, 0, min(s.cfg.seedRows, s.src.Len()), s.opts.columns)
+		if err != nil {
 			return err
 		}
+		s.seedSum = &sum
 	}
-
-	// Clear the warmup data
-	if err := clearTable(ctx, pool); err != nil {
+	sum, err := checksumRows(setup.src, setup.offset, n, s.opts.columns)
+	if err != nil {
 		return err
 	}
+	return validateChecksum(ctx, s.pool, s.opts.table, s.opts.columns, *s.seedSum+sum)
+}
 
-	return nil
+// result summarizes the samples run so far.
+func (s *steadyState) result() Result {
+	cfg := s.cfg
+	kept := cfg.keptSamples(s.durations)
+	mean := calculateMean(kept)
+	stdDev := calculateStdDev(kept, mean)
+	samples := len(s.durations)
+	bootLo, bootHi := bootstrapCI95(kept, cfg.bootstrap, cfg.seed)
+
+	return Result{
+		op:          cfg.op,
+		mix:         cfg.mixRatio.String(),
+		tableType:   cfg.tableType,
+		execMode:    cfg.execMode,
+		pipeline:    cfg.pipelineDepth,
+		blobSize:    cfg.blobSize,
+		indexes:     cfg.secondaryIndexes,
+		rebuilt:     cfg.rebuildIndexes,
+		asyncCommit: cfg.asyncCommit,
+		savepoint:   cfg.savepointEvery,
+		foreignKeys: cfg.foreignKeys,
+		fkEnforced:  cfg.enforceForeignKeys,
+		trigger:     cfg.trigger,
+		partitions:  cfg.partitions,
+		partitionBy: cfg.partitionBy,
+		returning:   cfg.returning,
+		crossover:   cfg.crossover,
+		method:      cfg.method,
+		batchSize:   s.batchSize,
+		txSize:      s.opts.txSize,
+		workers:     cfg.workers,
+		rows:        s.totalRows,
+		duration:    time.Duration(float64(time.Second) * float64(s.totalRows) / mean),
+		rowsPerSec:  mean,
+		stdDev:      stdDev,
+		ci95:        calculateCI95(stdDev, len(kept)),
+		bootLo:      bootLo,
+		bootHi:      bootHi,
+		minRate:     slices.Min(s.durations),
+		maxRate:     slices.Max(s.durations),
+		medianRate:  calculateMedian(s.durations),
+		bytesPerSec: calculateMean(s.bandwidths),
+		samples:     samples,
+		rejected:    samples - len(kept),
+		retries:     s.retries,
+		converged:   s.converged,
+		fixed:       cfg.samples > 0,
+		latency:     calculateLatencyPercentiles(s.latencies),
+		buckets:     bucketLatencies(s.latencies),
+		startRows:   s.startRows,
+		rebuild:     s.rebuild / time.Duration(samples),
+		rebuildRate: float64(s.totalRows) / (s.elapsed + s.rebuild).Seconds(),
+		seedRows:    cfg.seedRows,
+		seeding:     s.seeding / time.Duration(max(s.seeds, 1)),
+		workerRates: workerRates(s.workers),
+		explain:     s.explained.mean(),
+		allocs:      s.allocs,
+		txTiming:    s.txTiming,
+		walPerRow:   float64(s.walBytes) / float64(s.totalRows),
+		walPerSec:   calculateMean(s.walRates),
+		size:        s.size,
+		sizes:       s.sizes,
+		pgStats:     s.pgStatsResult(),
+	}
 }
 
-// measureSteadyState runs the benchmark until performance stabilizes
-func measureSteadyState(ctx context.Context, pool *pgxpool.Pool, data []TestRow, batchSize int) (Result, error) {
-	const (
-		minSamples       = 5      // Minimum number of samples before checking stability
-		maxSamples       = 20     // Maximum samples to prevent infinite loops
-		targetCV         = 0.05   // Target coefficient of variation (5%)
-		sampleSize       = 100_000 // Number of rows per sample
-	)
-
-	var durations []float64
-	var totalRows int
-
-	for len(durations) < maxSamples {
-		// Clear table before each sample
-		if err := clearTable(ctx, pool); err != nil {
+// pgStatsResult returns the summed -pg-stats counters, or nil without
+// -pg-stats.
+func (s *steadyState) pgStatsResult() *pgStats {
+	if !s.cfg.pgStats {
+		return nil
+	}
+	return &s.pgStats
+}
+
+// rebuildIndexes recreates the secondary indexes dropped before a load and
+// returns how long that took.
+func rebuildIndexes(ctx context.Context, pool *pgxpool.Pool, cfg config) (time.Duration, error) {
+	start := time.Now()
+	if err := createSecondaryIndexes(ctx, pool, cfg.tableIdentifier(), cfg.tableColumns(), cfg.secondaryIndexes); err != nil {
+		return 0, err
+	}
+	took := time.Since(start)
+	fmt.Fprintf(progress, "    Rebuilt %d indexes in %v\n", cfg.secondaryIndexes, took.Round(time.Millisecond))
+	return took, nil
+}
+
+// measureForDuration inserts transactions of rows until cfg.duration has
+// elapsed and reports throughput from the total rows inserted. Each
+// committed transaction counts as a sample; its rate, scaled by the number
+// of workers, feeds the standard deviation.
+func measureForDuration(ctx context.Context, pool *pgxpool.Pool, src rowSource, cfg config, batchSize int) (Result, error) {
+	opts := cfg.insertOptions(batchSize)
+	op, err := newOperation(pool, src, cfg, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	ins := pgxInserter{pool: pool, write: op.write, opts: opts}
+	start := time.Now()
+	setup, err := op.prepare(ctx, 0, 0)
+	addSince(&phases.prepare, start)
+	if err != nil {
+		return Result{}, err
+	}
+	src = setup.src
+
+	if cfg.rebuildIndexes {
+		if err := dropSecondaryIndexes(ctx, pool, opts.table); err != nil {
 			return Result{}, err
 		}
+	}
 
-		// Determine how many rows to insert for this sample
-		rowsToInsert := sampleSize
-		if rowsToInsert > len(data) {
-			rowsToInsert = len(data)
+	lsn, err := currentWALLSN(ctx, pool)
+	if err != nil {
+		return Result{}, err
+	}
+	var serverStats *pgStats
+	if cfg.pgStats {
+		before, err := readPGStats(ctx, pool, opts.table, cfg.pgStatements)
+		if err != nil {
+			return Result{}, err
 		}
-
-		// Measure this sample
-		duration, err := insertWithBatch(ctx, pool, data[:rowsToInsert], batchSize)
+		serverStats = &before
+	}
+	deadline := time.Now().Add(cfg.duration)
+	stopProgress := trackProgress(0, deadline)
+	var stats timedStats
+	var mem runtime.MemStats
+	if cfg.profileAllocs {
+		runtime.ReadMemStats(&mem)
+	}
+	start = time.Now()
+	if cfg.targetRate > 0 {
+		fmt.Fprintf(progress, "    Inserting at %.0f rows/sec for %v...\n", cfg.targetRate, cfg.duration)
+		stats, err = insertAtRate(ctx, ins, src, opts, cfg.workers, cfg.targetRate, deadline)
+	} else {
+		fmt.Fprintf(progress, "    Inserting for %v...\n", cfg.duration)
+		stats, err = insertUntil(ctx, ins, src, opts, cfg.workers, deadline)
+	}
+	addSince(&phases.measuring, start)
+	stopProgress()
+	if err != nil {
+		return Result{}, err
+	}
+	var allocs allocStats
+	if cfg.profileAllocs {
+		allocs.add(&mem, stats.rows)
+	}
+	var timing txTiming
+	if cfg.serverTiming {
+		timing.add(stats.insertStats)
+	}
+	if serverStats != nil {
+		after, err := readPGStats(ctx, pool, opts.table, cfg.pgStatements)
 		if err != nil {
 			return Result{}, err
 		}
-
-		rowsPerSec := float64(rowsToInsert) / duration.Seconds()
-		durations = append(durations, rowsPerSec)
-		totalRows += rowsToInsert
-
-		// Check if we've reached steady state
-		if len(durations) >= minSamples {
-			mean := calculateMean(durations)
-			stdDev := calculateStdDev(durations, mean)
-			cv := stdDev / mean
-
-			fmt.Printf("    Sample %d: %.0f rows/sec (mean: %.0f, CV: %.2f%%)\n",
-				len(durations), rowsPerSec, mean, cv*100)
-
-			if cv <= targetCV {
-				fmt.Printf("  Reached steady state after %d samples (CV: %.2f%%)\n", len(durations), cv*100)
-				return Result{
-					batchSize:  batchSize,
-					duration:   time.Duration(float64(time.Second) * float64(totalRows) / mean),
-					rowsPerSec: mean,
-					stdDev:     stdDev,
-					samples:    len(durations),
-				}, nil
-			}
-		} else {
-			fmt.Printf("    Sample %d: %.0f rows/sec\n", len(durations), rowsPerSec)
+		*serverStats = after.sub(*serverStats)
+	}
+	wal, err := walSince(ctx, pool, lsn)
+	if err != nil {
+		return Result{}, err
+	}
+	var rebuild time.Duration
+	if cfg.rebuildIndexes {
+		if rebuild, err = rebuildIndexes(ctx, pool, cfg); err != nil {
+			return Result{}, err
+		}
+	}
+	var explained explainStats
+	if cfg.explain {
+		es, err := explainBatch(ctx, pool, src, 0, opts)
+		if err != nil {
+			return Result{}, err
 		}
+		explained.add(es)
+	}
+	rowsAfter := setup.rowsBefore + op.rowDelta(stats.rows)
+	if cfg.validateRows {
+		if err := validateRowCount(ctx, pool, opts.table, rowsAfter); err != nil {
+			return Result{}, err
+		}
+	}
+	size, err := measureTableSize(ctx, pool, opts.table, rowsAfter)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Scale each transaction's rate by the worker count to estimate the
+	// aggregate throughput at that moment. At a target rate the workers
+	// aren't saturated, so the transaction rates say little about it.
+	rates := make([]float64, len(stats.txRates))
+	for i, r := range stats.txRates {
+		rates[i] = r * float64(cfg.workers)
+	}
+	rateStdDev := calculateStdDev(rates, calculateMean(rates))
+	bootLo, bootHi := bootstrapCI95(rates, cfg.bootstrap, cfg.seed)
+	var minRate, maxRate float64
+	if len(rates) > 0 {
+		minRate, maxRate = slices.Min(rates), slices.Max(rates)
 	}
 
-	// Reached max samples without stabilizing
-	mean := calculateMean(durations)
-	stdDev := calculateStdDev(durations, mean)
-	cv := stdDev / mean
-	fmt.Printf("  Reached max samples (%d) with CV: %.2f%%\n", maxSamples, cv*100)
+	fmt.Fprintf(progress, "  Inserted %d rows in %v\n", stats.rows, stats.elapsed.Round(time.Millisecond))
+	metrics.observeSample(stats.insertStats, float64(stats.rows)/stats.elapsed.Seconds())
 
 	return Result{
-		batchSize:  batchSize,
-		duration:   time.Duration(float64(time.Second) * float64(totalRows) / mean),
-		rowsPerSec: mean,
-		stdDev:     stdDev,
-		samples:    len(durations),
+		op:          cfg.op,
+		mix:         cfg.mixRatio.String(),
+		tableType:   cfg.tableType,
+		blobSize:    cfg.blobSize,
+		indexes:     cfg.secondaryIndexes,
+		rebuilt:     cfg.rebuildIndexes,
+		asyncCommit: cfg.asyncCommit,
+		savepoint:   cfg.savepointEvery,
+		foreignKeys: cfg.foreignKeys,
+		fkEnforced:  cfg.enforceForeignKeys,
+		trigger:     cfg.trigger,
+		partitions:  cfg.partitions,
+		partitionBy: cfg.partitionBy,
+		returning:   cfg.returning,
+		crossover:   cfg.crossover,
+		method:      cfg.method,
+		batchSize:   batchSize,
+		txSize:      opts.txSize,
+		workers:     cfg.workers,
+		rows:        stats.rows,
+		retries:     stats.retries,
+		duration:    stats.elapsed,
+		rowsPerSec:  float64(stats.rows) / stats.elapsed.Seconds(),
+		stdDev:      rateStdDev,
+		ci95:        calculateCI95(rateStdDev, len(rates)),
+		bootLo:      bootLo,
+		bootHi:      bootHi,
+		minRate:     minRate,
+		maxRate:     maxRate,
+		medianRate:  calculateMedian(rates),
+		bytesPerSec: float64(stats.bytes) / stats.elapsed.Seconds(),
+		samples:     len(rates),
+		converged:   true, // Time-bounded runs have no convergence gate
+		latency:     calculateLatencyPercentiles(stats.latencies),
+		buckets:     bucketLatencies(stats.latencies),
+		targetRate:  cfg.targetRate,
+		lag:         calculateLatencyPercentiles(stats.lags),
+		rebuild:     rebuild,
+		rebuildRate: float64(stats.rows) / (stats.elapsed + rebuild).Seconds(),
+		seedRows:    cfg.seedRows,
+		seeding:     setup.seeding,
+		workerRates: workerRates(stats.workers),
+		explain:     explained,
+		allocs:      allocs,
+		txTiming:    timing,
+		walPerRow:   float64(wal) / float64(max(stats.rows, 1)),
+		walPerSec:   float64(wal) / stats.elapsed.Seconds(),
+		size:        size,
+		pgStats:     serverStats,
 	}, nil
 }
 
-func calculateMean(values []float64) float64 {
-	sum := 0.0
-	for _, v := range values {
-		sum += v
+// resultLabel names a result by its batch size, adding the transaction
+// size when the two differ, the worker count when running concurrently and
+// its variantLabel.
+func resultLabel(r Result) string {
+	label := strconv.Itoa(r.batchSize)
+	if r.txSize != r.batchSize {
+		label += fmt.Sprintf("/tx=%d", r.txSize)
 	}
-	return sum / float64(len(values))
+	if r.workers > 1 {
+		label += fmt.Sprintf(" w=%d", r.workers)
+	}
+	if variant := variantLabel(r.params()); variant != "" {
+		label += " " + variant
+	}
+	return label
 }
 
-func calculateStdDev(values []float64, mean float64) float64 {
-	sumSquares := 0.0
-	for _, v := range values {
-		diff := v - mean
-		sumSquares += diff * diff
+// variantLabel names the variant flags a result was measured with: whether
+// the indexes were rebuilt after the load, whether commits were
+// asynchronous, the rows per savepoint, whether foreign keys were checked,
+// the trigger fired, the partitions and whether ids were returned. It is
+// empty for the plain run.
+func variantLabel(p runParams) string {
+	var parts []string
+	if p.rebuilt {
+		parts = append(parts, "rebuilt")
+	}
+	if p.async {
+		parts = append(parts, "async")
+	}
+	if p.savepoint > 0 {
+		parts = append(parts, fmt.Sprintf("sp=%d", p.savepoint))
+	}
+	if p.fkEnforced {
+		parts = append(parts, "fk")
+	}
+	if p.trigger != triggerNone {
+		parts = append(parts, p.trigger)
+	}
+	if p.partitions > 0 {
+		parts = append(parts, fmt.Sprintf("part=%d", p.partitions))
 	}
-	variance := sumSquares / float64(len(values))
-	return math.Sqrt(variance)
+	if p.returning {
+		parts = append(parts, "returning")
+	}
+	return strings.Join(parts, " ")
+}
+
+// resultMethods returns the distinct methods of results in the order they
+// were measured.
+func resultMethods(results []Result) []string {
+	var methods []string
+	for _, r := range results {
+		if !slices.Contains(methods, r.method) {
+			methods = append(methods, r.method)
+		}
+	}
+	return methods
+}
+
+// resultServers returns the distinct server names of results in the order
+// they were benchmarked, which is a single empty name unless several
+// servers were compared.
+func resultServers(results []Result) []string {
+	var servers []string
+	for _, r := range results {
+		if !slices.Contains(servers, r.server) {
+			servers = append(servers, r.server)
+		}
+	}
+	return servers
 }
 
-func displayHistogram(results []Result) {
-	fmt.Println("=== Throughput Results ===")
-	fmt.Println()
+// labeler names results in displays that mix methods or servers.
+type labeler struct {
+	methods, servers []string
+}
+
+func newLabeler(results []Result) labeler {
+	return labeler{methods: resultMethods(results), servers: resultServers(results)}
+}
 
-	// Find max throughput for scaling
+// label is resultLabel prefixed with the method when results were measured
+// with more than one, and with the server's number in the legend when
+// several servers were compared.
+func (l labeler) label(r Result) string {
+	label := resultLabel(r)
+	if len(l.methods) > 1 {
+		label = r.method + " " + label
+	}
+	if len(l.servers) > 1 {
+		label = fmt.Sprintf("[%d] %s", slices.Index(l.servers, r.server)+1, label)
+	}
+	return label
+}
+
+// runParams are the parameters that tell the results of one server apart.
+type runParams struct {
+	op, method                 string
+	batchSize, txSize, workers int
+	rebuilt, async             bool
+	savepoint                  int
+	fkEnforced                 bool
+	trigger                    string
+	partitions                 int
+	returning                  bool
+}
+
+// params returns the parameters r was measured with.
+func (r Result) params() runParams {
+	return runParams{r.op, r.method, r.batchSize, r.txSize, r.workers, r.rebuilt, r.asyncCommit, r.savepoint, r.fkEnforced, r.trigger, r.partitions, r.returning}
+}
+
+// findResult returns the result measured on server with p, if there is one.
+func findResult(results []Result, server string, p runParams) (Result, bool) {
+	i := slices.IndexFunc(results, func(r Result) bool {
+		return r.server == server && r.params() == p
+	})
+	if i < 0 {
+		return Result{}, false
+	}
+	return results[i], true
+}
+
+// setSpeedups sets the speedup of each result over the smallest batch size
+// measured with otherwise the same parameters on the same server.
+func setSpeedups(results []Result) {
+	type group struct {
+		server string
+		params runParams
+	}
+	key := func(r Result) group {
+		p := r.params()
+		p.batchSize, p.txSize = 0, 0
+		return group{r.server, p}
+	}
+	smallest := map[group]Result{}
+	for _, r := range results {
+		if base, ok := smallest[key(r)]; !ok || r.batchSize < base.batchSize {
+			smallest[key(r)] = r
+		}
+	}
+	for i, r := range results {
+		if base := smallest[key(r)]; base.rowsPerSec > 0 {
+			results[i].speedup = r.rowsPerSec / base.rowsPerSec
+		}
+	}
+}
+
+// groupByParameters reorders results so that those measured with the same
+// parameters on different servers are adjacent, keeping the order in which
+// the parameters were first measured. Under -method=compare the methods are
+// paired too, so that their bars are side by side.
+func groupByParameters(results []Result) []Result {
+	key := func(r Result) runParams {
+		p := r.params()
+		if r.crossover {
+			p.method = ""
+		}
+		return p
+	}
+	order := map[runParams]int{}
+	for _, r := range results {
+		if _, ok := order[key(r)]; !ok {
+			order[key(r)] = len(order)
+		}
+	}
+	grouped := slices.Clone(results)
+	slices.SortStableFunc(grouped, func(a, b Result) int {
+		return cmp.Compare(order[key(a)], order[key(b)])
+	})
+	return grouped
+}
+
+func displayHistogram(w io.Writer, results []Result) {
+	labels := newLabeler(results)
+	methods := labels.methods
+	if len(results) > 0 {
+		table := ""
+		if results[0].tableType != tableLogged {
+			table = ", table: " + results[0].tableType
+		}
+		if results[0].execMode != execCacheStatement {
+			table += ", exec mode: " + results[0].execMode
+		}
+		if results[0].pipeline > 0 {
+			table += fmt.Sprintf(", pipeline depth: %d", results[0].pipeline)
+		}
+		if results[0].blobSize > 0 {
+			table += ", bars by MB/sec"
+		}
+		op := results[0].op
+		if op == opMix {
+			// Every statement counts as a row, so rows/sec is ops/sec
+			op += " " + results[0].mix + ", rows are statements"
+		}
+		fmt.Fprintf(w, "=== Throughput Results (op: %s, method: %s%s) ===\n", op, strings.Join(methods, ", "), table)
+	} else {
+		fmt.Fprintln(w, "=== Throughput Results ===")
+	}
+	fmt.Fprintln(w)
+	if len(labels.servers) > 1 {
+		for i, s := range labels.servers {
+			fmt.Fprintf(w, "[%d] %s\n", i+1, s)
+		}
+		fmt.Fprintln(w)
+	}
+	// Results arrive in the order they ran, which only needs recording when
+	// it wasn't the ascending one
+	if len(results) > 0 && results[0].ordering != "" {
+		order := make([]string, len(results))
+		for i, r := range results {
+			order[i] = labels.label(r)
+		}
+		fmt.Fprintf(w, "Run order (%s): %s\n\n", results[0].ordering, strings.Join(order, ", "))
+	}
+	results = groupByParameters(results)
+
+	// Find max throughput for scaling. Blob rows are about bandwidth, so
+	// their bars show MB/sec instead of rows/sec
+	throughput := func(r Result) float64 { return r.rowsPerSec }
+	if len(results) > 0 && results[0].blobSize > 0 {
+		throughput = func(r Result) float64 { return r.bytesPerSec }
+	}
 	maxThroughput := 0.0
 	for _, r := range results {
-		if r.rowsPerSec > maxThroughput {
-			maxThroughput = r.rowsPerSec
+		if throughput(r) > maxThroughput {
+			maxThroughput = throughput(r)
 		}
 	}
 
 	// Display histogram
 	const barWidth = 50
 	for _, r := range results {
-		barLength := int((r.rowsPerSec / maxThroughput) * barWidth)
+		barLength := int((throughput(r) / maxThroughput) * barWidth)
 		bar := ""
 		for i := 0; i < barLength; i++ {
 			bar += "█"
 		}
 
 		cv := (r.stdDev / r.rowsPerSec) * 100
-		fmt.Printf("%-11d | %-50s | %10.0f ± %6.0f rows/sec (CV: %4.1f%%, n=%d)\n",
-			r.batchSize, bar, r.rowsPerSec, r.stdDev, cv, r.samples)
+		note := ""
+		if r.rejected > 0 {
+			note += fmt.Sprintf(", %d rejected", r.rejected)
+		}
+		if r.retries > 0 {
+			note += fmt.Sprintf(", %d retries", r.retries)
+		}
+		if r.fixed {
+			note += ", fixed"
+		} else if !r.converged {
+			note += " not converged"
+		}
+		fmt.Fprintf(w, "%-11s | %-50s | %10.0f ± %6.0f rows/sec %6.1f×, %7.1f MB/sec (CV: %4.1f%%, n=%d%s)\n",
+			labels.label(r), bar, r.rowsPerSec, r.stdDev, r.speedup, r.bytesPerSec/1e6, cv, r.samples, note)
+		fmt.Fprintf(w, "%-11s | %-50s | mean %.0f ±%.0f (95%% CI), [%.0f…%.0f] rows/sec, median %.0f\n",
+			"", "", r.rowsPerSec, r.ci95, r.minRate, r.maxRate, r.medianRate)
+		if r.bootHi > 0 {
+			fmt.Fprintf(w, "%-11s | %-50s | bootstrap 95%% CI [%.0f…%.0f] rows/sec\n", "", "", r.bootLo, r.bootHi)
+		}
+		fmt.Fprintf(w, "%-11s | %-50s | tx latency p50=%v p90=%v p95=%v p99=%v\n",
+			"", "", r.latency.p50.Round(time.Microsecond), r.latency.p90.Round(time.Microsecond),
+			r.latency.p95.Round(time.Microsecond), r.latency.p99.Round(time.Microsecond))
+		fmt.Fprintf(w, "%-11s | %-50s | WAL %.0f bytes/row, %.1f MB/sec\n", "", "", r.walPerRow, r.walPerSec/1e6)
+		fmt.Fprintf(w, "%-11s | %-50s | table %.1f MB: heap %.0f bytes/row, indexes %.0f bytes/row\n",
+			"", "", float64(r.size.total)/1e6, r.size.heapPerRow(), r.size.indexesPerRow())
+		if p := r.pgStats; p != nil {
+			line := fmt.Sprintf("server cache hit %.1f%% (%d blocks read), I/O time %v",
+				hitRatio(p.blksHit, p.blksRead)*100, p.blksRead, p.ioTime.Round(time.Millisecond))
+			if p.statements {
+				line += fmt.Sprintf("; table statements hit %.1f%% (%d blocks read), I/O time %v",
+					hitRatio(p.stmtBlksHit, p.stmtBlksRead)*100, p.stmtBlksRead, p.stmtIOTime.Round(time.Millisecond))
+			}
+			fmt.Fprintf(w, "%-11s | %-50s | %s\n", "", "", line)
+		}
+		if len(r.workerRates) > 1 {
+			rates := make([]string, len(r.workerRates))
+			for i, rate := range r.workerRates {
+				rates[i] = strconv.FormatFloat(rate, 'f', 0, 64)
+			}
+			fmt.Fprintf(w, "%-11s | %-50s | per worker %s rows/sec, imbalance %.2fx\n",
+				"", "", strings.Join(rates, " "), workerImbalance(r.workerRates))
+		}
+		if t := r.txTiming; t.txs > 0 {
+			fmt.Fprintf(w, "%-11s | %-50s | server %.1f%% of %d transactions, network + client overhead %v per transaction\n",
+				"", "", t.serverShare()*100, t.txs, t.overheadPerTx().Round(time.Microsecond))
+		}
+		if a := r.allocs; a.rows > 0 {
+			fmt.Fprintf(w, "%-11s | %-50s | client %.0f bytes/row in %.1f allocs/row, %.1f GCs per million rows\n",
+				"", "", a.bytesPerRow(), a.allocsPerRow(), a.gcsPerMillion())
+		}
+		if e := r.explain; e.runs > 0 {
+			fmt.Fprintf(w, "%-11s | %-50s | explain %d rows: planning %v, execution %v, shared hit=%d read=%d dirtied=%d\n",
+				"", "", e.rows, e.planning.Round(time.Microsecond), e.execution.Round(time.Microsecond),
+				e.sharedHit, e.sharedRead, e.sharedDirty)
+		}
+		if r.targetRate > 0 {
+			fmt.Fprintf(w, "%-11s | %-50s | target %.0f rows/sec, start lag p50=%v p99=%v\n",
+				"", "", r.targetRate, r.lag.p50.Round(time.Microsecond), r.lag.p99.Round(time.Microsecond))
+		}
+		if r.rebuilt {
+			fmt.Fprintf(w, "%-11s | %-50s | %d indexes rebuilt in %v per sample, %.0f rows/sec including the rebuild\n",
+				"", "", r.indexes, r.rebuild.Round(time.Millisecond), r.rebuildRate)
+		}
+		if r.seedRows > 0 {
+			fmt.Fprintf(w, "%-11s | %-50s | seeded with %d rows in %v\n", "", "", r.seedRows, r.seeding.Round(time.Millisecond))
+		}
+		if len(r.startRows) > 0 {
+			fmt.Fprintf(w, "%-11s | %-50s | sample start rows: %s\n", "", "", (*intList)(&r.startRows).String())
+		}
+		if len(r.sizes) > 0 {
+			growth := make([]string, len(r.sizes))
+			for i, s := range r.sizes {
+				growth[i] = strconv.FormatFloat(float64(s)/1e6, 'f', 1, 64)
+			}
+			fmt.Fprintf(w, "%-11s | %-50s | table MB after each sample: %s\n", "", "", strings.Join(growth, " "))
+		}
+		displayLatencyBuckets(w, r.buckets)
+		fmt.Fprintln(w)
+	}
+
+	displaySummary(w, results, labels)
+
+	if batchSizes, workerCounts := matrixAxes(results); len(workerCounts) > 1 {
+		displayMatrix(w, results, batchSizes, workerCounts)
+	}
+}
+
+// workerImbalance returns the ratio of the fastest worker's rows/sec to
+// the slowest's, which is 1 when the work was evenly spread.
+func workerImbalance(rates []float64) float64 {
+	lo, hi := slices.Min(rates), slices.Max(rates)
+	if lo <= 0 {
+		return math.Inf(1)
+	}
+	return hi / lo
+}
+
+// displaySummary prints the geometric mean of rows/sec over results, which
+// unlike the arithmetic mean isn't dominated by the fastest batch sizes,
+// and the fastest and slowest result. With several servers each gets its
+// own summary.
+func displaySummary(w io.Writer, results []Result, labels labeler) {
+	if len(results) == 0 {
+		return
+	}
+	for i, server := range labels.servers {
+		var rates, bandwidths []float64
+		fastest, slowest := -1, -1
+		for j, r := range results {
+			if r.server != server {
+				continue
+			}
+			rates = append(rates, r.rowsPerSec)
+			bandwidths = append(bandwidths, r.bytesPerSec)
+			if fastest < 0 || r.rowsPerSec > results[fastest].rowsPerSec {
+				fastest = j
+			}
+			if slowest < 0 || r.rowsPerSec < results[slowest].rowsPerSec {
+				slowest = j
+			}
+		}
+		prefix := ""
+		if len(labels.servers) > 1 {
+			prefix = fmt.Sprintf("[%d] ", i+1)
+		}
+		fmt.Fprintf(w, "%sGeometric mean: %.0f rows/sec over %d results\n", prefix, calculateGeoMean(rates), len(rates))
+		if results[0].blobSize > 0 {
+			fmt.Fprintf(w, "%sGeometric mean: %.1f MB/sec\n", prefix, calculateGeoMean(bandwidths)/1e6)
+		}
+		fmt.Fprintf(w, "%sFastest: %s at %.0f rows/sec, slowest: %s at %.0f rows/sec\n", prefix,
+			labels.label(results[fastest]), results[fastest].rowsPerSec, labels.label(results[slowest]), results[slowest].rowsPerSec)
+	}
+	fmt.Fprintln(w)
+}
+
+// matrixAxes returns the distinct batch sizes and worker counts of results
+// in the order they were measured.
+func matrixAxes(results []Result) (batchSizes, workerCounts []int) {
+	for _, r := range results {
+		if !slices.Contains(batchSizes, r.batchSize) {
+			batchSizes = append(batchSizes, r.batchSize)
+		}
+		if !slices.Contains(workerCounts, r.workers) {
+			workerCounts = append(workerCounts, r.workers)
+		}
+	}
+	return batchSizes, workerCounts
+}
+
+// matrixPanel identifies one grid of the matrix: the results measured on a
+// server with the same parameters other than batch size and workers.
+type matrixPanel struct {
+	server string
+	params runParams // With the batch size, transaction size and workers left out
+}
+
+// panelOf returns the panel r is drawn in.
+func panelOf(r Result) matrixPanel {
+	p := r.params()
+	p.batchSize, p.txSize, p.workers = 0, 0, 0
+	return matrixPanel{server: r.server, params: p}
+}
+
+// title names the panel by its method, variant and server.
+func (p matrixPanel) title() string {
+	title := "method " + p.params.method
+	if variant := variantLabel(p.params); variant != "" {
+		title += ", " + variant
+	}
+	if p.server != "" {
+		title += ", server " + p.server
+	}
+	return title
+}
+
+// matrixPanels returns the distinct panels of results in the order they
+// were measured.
+func matrixPanels(results []Result) []matrixPanel {
+	var panels []matrixPanel
+	for _, r := range results {
+		if p := panelOf(r); !slices.Contains(panels, p) {
+			panels = append(panels, p)
+		}
+	}
+	return panels
+}
+
+// matrixLookup returns the result of panel for a batch size and worker
+// count.
+func matrixLookup(results []Result, panel matrixPanel, batchSize, workers int) (Result, bool) {
+	for _, r := range results {
+		if panelOf(r) == panel && r.batchSize == batchSize && r.workers == workers {
+			return r, true
+		}
+	}
+	return Result{}, false
+}
+
+// displayMatrix draws rows/sec as a grid of batch sizes by worker counts,
+// one per matrixPanel, shading each cell by its throughput relative
+// to the best one.
+func displayMatrix(w io.Writer, results []Result, batchSizes, workerCounts []int) {
+	shades := []rune(" ░▒▓█")
+
+	maxThroughput := 0.0
+	for _, r := range results {
+		maxThroughput = max(maxThroughput, r.rowsPerSec)
+	}
+
+	fmt.Fprintln(w, "=== Throughput by Batch Size and Workers (rows/sec) ===")
+	fmt.Fprintln(w)
+	panels := matrixPanels(results)
+	for _, panel := range panels {
+		if len(panels) > 1 {
+			fmt.Fprintln(w, panel.title())
+		}
+		fmt.Fprintf(w, "%11s", "batch \\ w")
+		for _, workers := range workerCounts {
+			fmt.Fprintf(w, " | %12d", workers)
+		}
+		fmt.Fprintln(w)
+		for _, batchSize := range batchSizes {
+			fmt.Fprintf(w, "%11d", batchSize)
+			for _, workers := range workerCounts {
+				r, ok := matrixLookup(results, panel, batchSize, workers)
+				if !ok {
+					fmt.Fprintf(w, " | %12s", "-")
+					continue
+				}
+				shade := ' '
+				if maxThroughput > 0 {
+					shade = shades[int(r.rowsPerSec/maxThroughput*float64(len(shades)-1))]
+				}
+				fmt.Fprintf(w, " | %c %10.0f", shade, r.rowsPerSec)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// displayLatencyBuckets draws the distribution of transaction latencies as
+// a small horizontal bar chart, one line per bucket.
+func displayLatencyBuckets(w io.Writer, buckets []latencyBucket) {
+	const barWidth = 30
+
+	maxCount := 0
+	for _, b := range buckets {
+		maxCount = max(maxCount, b.count)
+	}
+	if maxCount == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%-11s   tx latency (µs)\n", "")
+	for _, b := range buckets {
+		bar := strings.Repeat("▇", b.count*barWidth/maxCount)
+		fmt.Fprintf(w, "%-11s   ≤ %10d | %-30s | %d\n", "", b.upperMicros, bar, b.count)
 	}
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// runMetadata identifies where and from which build a run came, so that
+// archived results can be told apart.
+type runMetadata struct {
+	label     string
+	hostname  string
+	numCPU    int
+	goVersion string
+	commit    string // VCS revision of the build, if recorded
+}
+
+// collectMetadata gathers the metadata of the current process.
+func collectMetadata(label string) runMetadata {
+	md := runMetadata{label: label, numCPU: runtime.NumCPU(), goVersion: runtime.Version()}
+	md.hostname, _ = os.Hostname()
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				md.commit = s.Value + md.commit
+			case "vcs.modified":
+				if s.Value == "true" {
+					md.commit += "-dirty"
+				}
+			}
+		}
+	}
+	return md
+}
+
+// jsonMetadata is the serialized form of the run's metadata.
+type jsonMetadata struct {
+	Label     string       `json:"label,omitempty"`
+	Hostname  string       `json:"hostname"`
+	Timestamp string       `json:"timestamp"`
+	NumCPU    int          `json:"num_cpu"`
+	GoVersion string       `json:"go_version"`
+	Commit    string       `json:"commit,omitempty"`
+	Servers   []jsonServer `json:"servers"`
+	Timing    *jsonTiming  `json:"timing,omitempty"`
+}
+
+type jsonServer struct {
+	Name          string            `json:"name,omitempty"`
+	Host          string            `json:"host"`
+	ServerVersion string            `json:"server_version"`
+	Transport     string            `json:"transport,omitempty"`
+	Settings      map[string]string `json:"settings,omitempty"`
+}
+
+func toJSONMetadata(info runInfo) jsonMetadata {
+	md := jsonMetadata{
+		Label:     info.label,
+		Hostname:  info.hostname,
+		Timestamp: info.started.UTC().Format(time.RFC3339),
+		NumCPU:    info.numCPU,
+		GoVersion: info.goVersion,
+		Commit:    info.commit,
+		Servers:   []jsonServer{},
+		Timing:    toJSONTiming(info.elapsed, info.phases),
+	}
+	for _, server := range info.servers {
+		js := jsonServer{Name: server.name, Host: server.host, ServerVersion: server.serverVersion, Transport: server.transport}
+		if len(server.settings) > 0 {
+			js.Settings = make(map[string]string, len(server.settings))
+			for _, s := range server.settings {
+				js.Settings[s.name] = s.value
+			}
+		}
+		md.Servers = append(md.Servers, js)
+	}
+	return md
+}
+
+// metadataLines returns the metadata as "key: value" pairs, in the order
+// they are printed by the line-oriented formats.
+func metadataLines(info runInfo) [][2]string {
+	var lines [][2]string
+	if info.label != "" {
+		lines = append(lines, [2]string{"label", info.label})
+	}
+	lines = append(lines,
+		[2]string{"hostname", info.hostname},
+		[2]string{"timestamp", info.started.UTC().Format(time.RFC3339)},
+		[2]string{"num_cpu", strconv.Itoa(info.numCPU)},
+		[2]string{"go_version", info.goVersion},
+	)
+	if info.commit != "" {
+		lines = append(lines, [2]string{"commit", info.commit})
+	}
+	return lines
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics is the live metrics registry, or nil when -metrics-addr is not
+// set. Its methods are safe to call on a nil receiver.
+var metrics *benchMetrics
+
+// benchMetrics holds the values exported to Prometheus.
+type benchMetrics struct {
+	rowsPerSec prometheus.Gauge
+	rowsTotal  prometheus.Counter
+	latency    prometheus.Histogram
+}
+
+// newBenchMetrics creates the metrics and registers them with the default
+// Prometheus registry, so it must only be called once.
+func newBenchMetrics() *benchMetrics {
+	buckets := make([]float64, len(latencyBucketBounds))
+	for i, bound := range latencyBucketBounds {
+		buckets[i] = float64(bound) / 1e6
+	}
+	m := &benchMetrics{
+		rowsPerSec: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pscale_rows_per_second",
+			Help: "Throughput of the most recent sample.",
+		}),
+		rowsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pscale_rows_total",
+			Help: "Rows written by measured samples.",
+		}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pscale_transaction_latency_seconds",
+			Help:    "Begin-to-commit time of each transaction.",
+			Buckets: buckets,
+		}),
+	}
+	prometheus.MustRegister(m.rowsPerSec, m.rowsTotal, m.latency)
+	return m
+}
+
+// observeSample records a completed sample: its throughput, the rows it
+// wrote and the latency of each of its transactions.
+func (m *benchMetrics) observeSample(stats insertStats, rowsPerSec float64) {
+	if m == nil {
+		return
+	}
+	m.rowsPerSec.Set(rowsPerSec)
+	m.rowsTotal.Add(float64(stats.rows))
+	for _, l := range stats.latencies {
+		m.latency.Observe(l.Seconds())
+	}
+}
+
+// serveMetrics starts an HTTP server exposing the default Prometheus
+// registry on addr at /metrics. The returned function shuts the server
+// down.
+func serveMetrics(addr string) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server failed", "err", err)
+		}
+	}()
+	slog.Info("serving metrics", "url", "http://"+ln.Addr().String()+"/metrics")
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestObserveSample(t *testing.T) {
+	var none *benchMetrics
+	none.observeSample(insertStats{rows: 1}, 1) // As without -metrics-addr
+
+	m := newBenchMetrics()
+	m.observeSample(insertStats{rows: 300, latencies: []time.Duration{3 * time.Millisecond, 40 * time.Millisecond}}, 1000)
+	m.observeSample(insertStats{rows: 200, latencies: []time.Duration{7 * time.Millisecond}}, 2000)
+
+	if got := testutil.ToFloat64(m.rowsPerSec); got != 2000 {
+		t.Errorf("pscale_rows_per_second = %v, want the last sample's 2000", got)
+	}
+	if got := testutil.ToFloat64(m.rowsTotal); got != 500 {
+		t.Errorf("pscale_rows_total = %v, want 500", got)
+	}
+
+	var out dto.Metric
+	if err := m.latency.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	h := out.GetHistogram()
+	if h.GetSampleCount() != 3 || math.Abs(h.GetSampleSum()-0.05) > 1e-9 {
+		t.Errorf("latency histogram holds %d transactions summing to %vs, want 3 summing to 0.05s", h.GetSampleCount(), h.GetSampleSum())
+	}
+	// Buckets are cumulative: 3ms falls under 5ms, 7ms under 10ms
+	want := map[float64]uint64{0.002: 0, 0.005: 1, 0.01: 2, 0.02: 2, 0.05: 3}
+	checked := 0
+	for _, b := range h.GetBucket() {
+		if n, ok := want[b.GetUpperBound()]; ok {
+			checked++
+			if b.GetCumulativeCount() != n {
+				t.Errorf("bucket le=%v holds %d transactions, want %d", b.GetUpperBound(), b.GetCumulativeCount(), n)
+			}
+		}
+	}
+	if checked != len(want) {
+		t.Errorf("found %d of the %d buckets checked", checked, len(want))
+	}
+}
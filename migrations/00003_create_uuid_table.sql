@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE test_data_uuid (
+    id UUID PRIMARY KEY,
+    data TEXT NOT NULL,
+    description TEXT NOT NULL,
+    counter1 INTEGER NOT NULL,
+    counter2 INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    payload JSONB
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE test_data_uuid;
+-- +goose StatementEnd
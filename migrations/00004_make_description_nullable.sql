@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE test_data ALTER COLUMN description DROP NOT NULL;
+ALTER TABLE test_data_uuid ALTER COLUMN description DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE test_data SET description = '' WHERE description IS NULL;
+ALTER TABLE test_data ALTER COLUMN description SET NOT NULL;
+UPDATE test_data_uuid SET description = '' WHERE description IS NULL;
+ALTER TABLE test_data_uuid ALTER COLUMN description SET NOT NULL;
+-- +goose StatementEnd
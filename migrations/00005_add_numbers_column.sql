@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE test_data ADD COLUMN numbers INTEGER[];
+ALTER TABLE test_data_uuid ADD COLUMN numbers INTEGER[];
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE test_data DROP COLUMN numbers;
+ALTER TABLE test_data_uuid DROP COLUMN numbers;
+-- +goose StatementEnd
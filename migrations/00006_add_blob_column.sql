@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE test_data ADD COLUMN blob BYTEA;
+ALTER TABLE test_data_uuid ADD COLUMN blob BYTEA;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE test_data DROP COLUMN blob;
+ALTER TABLE test_data_uuid DROP COLUMN blob;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE test_data ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE test_data_uuid ADD COLUMN updated_at TIMESTAMP;
+
+CREATE FUNCTION pscale_noop_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+    RETURN NEW;
+END;
+$$;
+
+CREATE FUNCTION pscale_timestamp_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+    NEW.updated_at := now();
+    RETURN NEW;
+END;
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION pscale_timestamp_trigger();
+DROP FUNCTION pscale_noop_trigger();
+ALTER TABLE test_data DROP COLUMN updated_at;
+ALTER TABLE test_data_uuid DROP COLUMN updated_at;
+-- +goose StatementEnd
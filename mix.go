@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// opMix is the -op that blends inserts, updates and deletes in the ratio
+// given by -mix.
+const opMix = "mix"
+
+// mixKinds are the statements a mix can contain, in the order of
+// mixRatio.weights.
+var mixKinds = []string{opInsert, opUpdate, opDelete}
+
+// mixRatio is a parsed -mix spec. The statements of a sample follow a
+// fixed pattern of sum(weights) positions, repeated, in which each kind is
+// spread as evenly as its weight allows.
+type mixRatio struct {
+	weights []int // Of each of mixKinds, reduced by their common divisor
+	pattern []int // Index into mixKinds of each position of the cycle
+}
+
+// parseMix parses a spec such as "insert:70,update:20,delete:10". Kinds
+// left out get no statements.
+func parseMix(spec string) (mixRatio, error) {
+	m := mixRatio{weights: make([]int, len(mixKinds))}
+	for _, part := range strings.Split(spec, ",") {
+		kind, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		i := slices.Index(mixKinds, kind)
+		if !ok || i < 0 {
+			return mixRatio{}, fmt.Errorf("invalid -mix %q: expected kind:weight pairs of insert, update and delete", spec)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return mixRatio{}, fmt.Errorf("invalid -mix %q: weight of %s must be a non-negative integer", spec, kind)
+		}
+		m.weights[i] += w
+	}
+
+	divisor := 0
+	for _, w := range m.weights {
+		divisor = gcd(divisor, w)
+	}
+	if divisor == 0 {
+		return mixRatio{}, fmt.Errorf("invalid -mix %q: the weights must not all be zero", spec)
+	}
+	total := 0
+	for i := range m.weights {
+		m.weights[i] /= divisor
+		total += m.weights[i]
+	}
+
+	// Smooth weighted round-robin: each position goes to the kind that is
+	// furthest behind its share
+	current := make([]int, len(m.weights))
+	for range total {
+		best := 0
+		for i, w := range m.weights {
+			current[i] += w
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		m.pattern = append(m.pattern, best)
+	}
+	return m, nil
+}
+
+// count returns how many of the first n statements are of kind.
+func (m mixRatio) count(kind string, n int) int {
+	k := slices.Index(mixKinds, kind)
+	c := n / len(m.pattern) * m.weights[k]
+	for _, p := range m.pattern[:n%len(m.pattern)] {
+		if p == k {
+			c++
+		}
+	}
+	return c
+}
+
+// String formats m as a -mix spec of its reduced weights.
+func (m mixRatio) String() string {
+	var parts []string
+	for i, w := range m.weights {
+		if w > 0 {
+			parts = append(parts, fmt.Sprintf("%s:%d", mixKinds[i], w))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// mixRows is a rowSource that turns the rows of src into the statements of
+// a mix. Inserts write the row as it is. The deletes of a sample take the
+// last deletes of ids, each once, and its updates cycle through the ids
+// before them, so that no row is updated after it was deleted.
+type mixRows struct {
+	src     rowSource
+	ratio   mixRatio
+	ids     []int64
+	deletes int
+}
+
+func (m mixRows) Len() int { return m.src.Len() }
+
+func (m mixRows) Stream(offset, n int) rowStream {
+	return &mixStream{mixRows: m, rowStream: m.src.Stream(offset, n), next: offset}
+}
+
+type mixStream struct {
+	mixRows
+	rowStream
+	next int
+}
+
+func (s *mixStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	row.kind = mixKinds[s.ratio.pattern[s.next%len(s.ratio.pattern)]]
+	switch row.kind {
+	case opUpdate:
+		kept := s.ids[:len(s.ids)-s.deletes]
+		row.id = kept[s.ratio.count(opUpdate, s.next)%len(kept)]
+	case opDelete:
+		row.id = s.ids[len(s.ids)-1-s.ratio.count(opDelete, s.next)]
+	}
+	s.next++
+	return row, true
+}
+
+// mixWithBatch pipelines one statement per row with pgx.Batch: an INSERT,
+// an UPDATE of the counters or a DELETE by primary key, as the row's kind
+// says.
+func mixWithBatch(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	insert := insertSQL(opts.table, opts.columns)
+	update := "UPDATE " + opts.table.Sanitize() + " SET counter1 = $1, counter2 = $2 WHERE id = $3"
+	del := "DELETE FROM " + opts.table.Sanitize() + " WHERE id = $1"
+
+	return runTransactions(ctx, pool, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		batch := &pgx.Batch{}
+		for _, row := range rows {
+			switch row.kind {
+			case opUpdate:
+				batch.Queue(update, row.counter1, row.counter2, row.id)
+			case opDelete:
+				batch.Queue(del, row.id)
+			default:
+				batch.Queue(insert, row.values(nil)...)
+			}
+		}
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	opInsert = "insert"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// operation describes the statement being benchmarked: how rows are
+// written and how the table is prepared before each sample.
+type operation struct {
+	write insertFunc
+	// prepare readies the table for sample number sample, which touches n
+	// rows, and describes where the sample reads its rows from.
+	prepare func(ctx context.Context, sample, n int) (sampleSetup, error)
+	// rowDelta returns the change in the table's row count when n rows
+	// are written.
+	rowDelta func(n int) int
+}
+
+// sampleSetup is the result of preparing a sample.
+type sampleSetup struct {
+	src        rowSource
+	offset     int
+	rowsBefore int           // Rows in the table before the sample runs
+	conflicts  int           // Rows of the sample that already exist and are skipped
+	seeding    time.Duration // Time taken to load -seed-rows before the sample
+}
+
+// newOperation returns the operation selected by cfg.op.
+func newOperation(pool *pgxpool.Pool, src rowSource, cfg config, opts insertOptions) (operation, error) {
+	switch cfg.op {
+	case opInsert:
+		insert, ok := insertMethods[cfg.method]
+		if !ok {
+			return operation{}, fmt.Errorf("unknown insert method %q", cfg.method)
+		}
+		return operation{
+			write:    insert,
+			rowDelta: func(n int) int { return n },
+			prepare: func(ctx context.Context, sample, n int) (sampleSetup, error) {
+				// Clear table before each sample, or only before the first
+				// one when the table is allowed to grow
+				setup := sampleSetup{src: src, rowsBefore: cfg.seedRows + sample*n}
+				if !cfg.noTruncate || sample == 0 {
+					if err := clearTable(ctx, pool, opts.table); err != nil {
+						return sampleSetup{}, err
+					}
+					setup.rowsBefore = 0
+					if cfg.seedRows > 0 {
+						var err error
+						if setup.seeding, err = seedTable(ctx, pool, src, opts, cfg.seedRows); err != nil {
+							return sampleSetup{}, err
+						}
+						setup.rowsBefore = cfg.seedRows
+					}
+				}
+				if cfg.method == methodUpsert {
+					return prepareUpsert(ctx, pool, setup, cfg, opts, n)
+				}
+				return setup, nil
+			},
+		}, nil
+
+	case opUpdate:
+		var ids []int64
+		return operation{
+			write:    updateWithBatch,
+			rowDelta: func(int) int { return 0 },
+			prepare: func(ctx context.Context, sample, n int) (sampleSetup, error) {
+				// Populate once; later samples update the same rows again,
+				// accumulating dead tuples as a real workload would
+				if ids == nil {
+					var err error
+					if ids, err = repopulate(ctx, pool, src, opts, cfg.prepopulateRows); err != nil {
+						return sampleSetup{}, err
+					}
+				}
+				return sampleSetup{
+					src:        keyedRows{ids: ids, sample: sample},
+					offset:     sample * n % len(ids),
+					rowsBefore: len(ids),
+				}, nil
+			},
+		}, nil
+
+	case opDelete:
+		var ids []int64
+		next := 0
+		return operation{
+			write:    deleteWithBatch,
+			rowDelta: func(n int) int { return -n },
+			prepare: func(ctx context.Context, sample, n int) (sampleSetup, error) {
+				// Deleted rows are gone for good, so reload the table
+				// whenever the remaining rows can't cover a whole sample
+				if ids == nil || next+n > len(ids) {
+					var err error
+					if ids, err = repopulate(ctx, pool, src, opts, max(cfg.prepopulateRows, n)); err != nil {
+						return sampleSetup{}, err
+					}
+					next = 0
+				}
+				offset := next
+				next += n
+				return sampleSetup{
+					src:        keyedRows{ids: ids, sample: sample},
+					offset:     offset,
+					rowsBefore: len(ids) - offset,
+				}, nil
+			},
+		}, nil
+
+	case opMix:
+		ratio := cfg.mixRatio
+		return operation{
+			write: mixWithBatch,
+			rowDelta: func(n int) int {
+				return ratio.count(opInsert, n) - ratio.count(opDelete, n)
+			},
+			prepare: func(ctx context.Context, sample, n int) (sampleSetup, error) {
+				// Reload the table for every sample, so that each starts
+				// from the same rows however many the last one deleted
+				ids, err := repopulate(ctx, pool, src, opts, cfg.prepopulateRows)
+				if err != nil {
+					return sampleSetup{}, err
+				}
+				deletes := ratio.count(opDelete, n)
+				if deletes > len(ids) || deletes == len(ids) && ratio.count(opUpdate, n) > 0 {
+					return sampleSetup{}, fmt.Errorf("-prepopulate-rows (%d) must exceed the %d rows each sample deletes", len(ids), deletes)
+				}
+				return sampleSetup{
+					src:        mixRows{src: src, ratio: ratio, ids: ids, deletes: deletes},
+					rowsBefore: len(ids),
+				}, nil
+			},
+		}, nil
+
+	default:
+		return operation{}, fmt.Errorf("unknown operation %q", cfg.op)
+	}
+}
+
+// seedTable loads the first n rows of src into opts.table with COPY, in a
+// single transaction, and returns how long that took.
+func seedTable(ctx context.Context, pool *pgxpool.Pool, src rowSource, opts insertOptions, n int) (time.Duration, error) {
+	n = min(n, src.Len())
+	fmt.Fprintf(progress, "    Populating %d rows...\n", n)
+	start := time.Now()
+	load := insertOptions{table: opts.table, columns: opts.columns, batchSize: 10_000, txSize: n, txOptions: opts.txOptions}
+	if _, err := insertRows(ctx, pgxInserter{pool: pool, write: insertWithCopy, opts: load}, src, 0, n, load.batchSize); err != nil {
+		return 0, fmt.Errorf("failed to populate table: %w", err)
+	}
+	return time.Since(start), nil
+}
+
+// repopulate truncates opts.table, loads the first n rows of src into it
+// with seedTable and returns the primary keys of the loaded rows.
+func repopulate(ctx context.Context, pool *pgxpool.Pool, src rowSource, opts insertOptions, n int) ([]int64, error) {
+	if err := clearTable(ctx, pool, opts.table); err != nil {
+		return nil, err
+	}
+	if _, err := seedTable(ctx, pool, src, opts, n); err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, "SELECT id FROM "+opts.table.Sanitize()+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+// keyedRows is a rowSource over existing primary keys, used by operations
+// that modify rows rather than insert them. Offsets wrap around so samples
+// can cycle through the keys.
+type keyedRows struct {
+	ids    []int64
+	sample int
+}
+
+func (k keyedRows) Len() int { return len(k.ids) }
+
+func (k keyedRows) Stream(offset, n int) rowStream {
+	return &generatedStream{gen: k.row, next: offset, end: offset + n}
+}
+
+func (k keyedRows) row(i int) TestRow {
+	id := k.ids[i%len(k.ids)]
+	return TestRow{
+		id:       id,
+		counter1: k.sample,
+		counter2: int(id % math.MaxInt32),
+	}
+}
+
+// updateWithBatch updates the counters of existing rows by primary key,
+// pipelining one UPDATE per row with pgx.Batch.
+func updateWithBatch(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	sql := "UPDATE " + opts.table.Sanitize() + " SET counter1 = $1, counter2 = $2 WHERE id = $3"
+
+	return runTransactions(ctx, pool, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		batch := &pgx.Batch{}
+		for _, row := range rows {
+			batch.Queue(sql, row.counter1, row.counter2, row.id)
+		}
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+// deleteWithBatch deletes existing rows by primary key, issuing one
+// DELETE ... WHERE id = ANY($1) per batch.
+func deleteWithBatch(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	sql := "DELETE FROM " + opts.table.Sanitize() + " WHERE id = ANY($1)"
+	ids := make([]int64, 0, min(opts.batchSize, opts.txSize, rows.Remaining()))
+
+	return runTransactions(ctx, pool, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		ids = ids[:0]
+		for _, row := range rows {
+			ids = append(ids, row.id)
+		}
+		_, err := tx.Exec(ctx, sql, ids)
+		return err
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// benchmarkRun is one of the combinations of parameters a run measures.
+type benchmarkRun struct {
+	cfg       config
+	batchSize int
+}
+
+// benchmarkRuns returns every configured combination of method, batch size
+// and worker count, each once with the secondary indexes present and, with
+// -rebuild-indexes, once more rebuilding them after the load. All of that
+// is repeated with -async-commit, again with -savepoint-every, again with
+// the -foreign-keys enforced, again with the -trigger, again on the
+// -partitions table and again with -returning, so that each can be
+// compared with the plain run. They are in ascending order
+// unless -shuffle asks for a random one, seeded by -seed so that it can be
+// repeated.
+func benchmarkRuns(cfg config) []benchmarkRun {
+	plain := cfg
+	plain.rebuildIndexes = false
+	plain.asyncCommit = false
+	plain.savepointEvery = 0
+	plain.enforceForeignKeys = false
+	plain.trigger = triggerNone
+	plain.partitions, plain.partitionBy = 0, ""
+	plain.returning = false
+	variants := []config{plain}
+	vary := func(enabled bool, set func(*config)) {
+		if !enabled {
+			return
+		}
+		for _, v := range variants {
+			set(&v)
+			variants = append(variants, v)
+		}
+	}
+	vary(cfg.rebuildIndexes, func(c *config) { c.rebuildIndexes = true })
+	vary(cfg.asyncCommit, func(c *config) { c.asyncCommit = true })
+	vary(cfg.savepointEvery > 0, func(c *config) { c.savepointEvery = cfg.savepointEvery })
+	vary(cfg.foreignKeys > 0, func(c *config) { c.enforceForeignKeys = true })
+	vary(cfg.trigger != triggerNone, func(c *config) { c.trigger = cfg.trigger })
+	vary(cfg.partitions > 0, func(c *config) {
+		c.table = partitionedTable(cfg.table)
+		c.partitions, c.partitionBy = cfg.partitions, cfg.partitionBy
+	})
+	vary(cfg.returning, func(c *config) { c.returning = true })
+
+	var runs []benchmarkRun
+	for _, method := range cfg.methods {
+		for _, batchSize := range cfg.batchSizes {
+			for _, workers := range cfg.workerCounts {
+				for _, run := range variants {
+					run.method = method
+					run.workers = workers
+					runs = append(runs, benchmarkRun{cfg: run, batchSize: batchSize})
+				}
+			}
+		}
+	}
+	if cfg.shuffle {
+		rand.New(rand.NewPCG(cfg.seed, 0)).Shuffle(len(runs), func(i, j int) {
+			runs[i], runs[j] = runs[j], runs[i]
+		})
+	}
+	return runs
+}
+
+// runInterleaved measures runs by taking turns: one sample of each that
+// hasn't yet converged, round after round, so that a slow drift of the
+// server or its caches hits them all alike rather than favouring the last
+// ones. Each is warmed up before the first round. On error it returns the
+// results of the runs that had finished.
+func runInterleaved(ctx context.Context, pool *pgxpool.Pool, src rowSource, runs []benchmarkRun) ([]Result, error) {
+	states := make([]*steadyState, len(runs))
+	total := 0
+	for i, run := range runs {
+		fmt.Fprintln(progress, runLabel(run.cfg, run.batchSize))
+		if err := warmUp(ctx, pool, src, run.cfg, run.batchSize); err != nil {
+			return nil, err
+		}
+		s, err := newSteadyState(pool, src, run.cfg, run.batchSize)
+		if err != nil {
+			return nil, err
+		}
+		states[i] = s
+		total += run.cfg.maxSamples * s.rowsPerSample()
+	}
+
+	stopProgress := trackProgress(total, time.Time{})
+	defer stopProgress()
+
+	finished := func() []Result {
+		var results []Result
+		for i, s := range states {
+			if s.done {
+				result := s.result()
+				result.order, result.ordering = i+1, orderInterleaved
+				results = append(results, result)
+			}
+		}
+		return results
+	}
+	for pending := len(states); pending > 0; {
+		for i, s := range states {
+			if s.done {
+				continue
+			}
+			fmt.Fprintln(progress, runLabel(runs[i].cfg, runs[i].batchSize))
+			if err := s.sample(ctx); err != nil {
+				return finished(), fmt.Errorf("failed to measure steady state: %w", err)
+			}
+			if s.done {
+				result := s.result()
+				reportThroughput(result)
+				stream.summary(result)
+				pending--
+			}
+		}
+	}
+	return finished(), nil
+}
+
+// Values of Result.ordering.
+const (
+	orderShuffled    = "shuffled"
+	orderInterleaved = "interleaved"
+)
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatText      = "text"
+	formatJSON      = "json"
+	formatBenchmark = "benchmark"
+	formatCSV       = "csv"
+	formatMarkdown  = "markdown"
+	formatHTML      = "html"
+)
+
+// runInfo describes the benchmark run as a whole, for formats that record
+// it alongside the results.
+type runInfo struct {
+	started time.Time
+	elapsed time.Duration // Wall-clock time of the whole run
+	phases  phaseTimes
+	servers []serverInfo
+	runMetadata
+}
+
+// serverInfo describes one of the servers benchmarked.
+type serverInfo struct {
+	name          string // Set when comparing several servers, see Result.server
+	host          string
+	serverVersion string
+	transport     string // Unix socket or TCP, with the TLS version and cipher if encrypted
+	settings      []serverSetting
+	overhead      []overheadResult // Only measured with -overhead
+}
+
+// jsonOutput is the document written by -format=json: the run's metadata
+// followed by its results.
+type jsonOutput struct {
+	Metadata jsonMetadata `json:"metadata"`
+	Results  []jsonResult `json:"results"`
+}
+
+// jsonResult is the serialized form of a Result.
+type jsonResult struct {
+	Op                  string              `json:"op"`
+	Mix                 string              `json:"mix,omitempty"`
+	Method              string              `json:"method"`
+	BatchSize           int                 `json:"batch_size"`
+	TxSize              int                 `json:"tx_size"`
+	Workers             int                 `json:"workers"`
+	TableType           string              `json:"table_type"`
+	ExecMode            string              `json:"exec_mode,omitempty"`
+	PipelineDepth       int                 `json:"pipeline_depth,omitempty"`
+	RunOrder            int                 `json:"run_order"`
+	Ordering            string              `json:"ordering,omitempty"`
+	BlobSize            int                 `json:"blob_size,omitempty"`
+	Server              string              `json:"server,omitempty"`
+	SecondaryIndexes    int                 `json:"secondary_indexes"`
+	IndexesRebuilt      bool                `json:"indexes_rebuilt"`
+	AsyncCommit         bool                `json:"async_commit,omitempty"`
+	Speedup             float64             `json:"speedup"`
+	SavepointEvery      int                 `json:"savepoint_every,omitempty"`
+	ForeignKeys         int                 `json:"foreign_keys,omitempty"`
+	ForeignKeysEnforced bool                `json:"foreign_keys_enforced,omitempty"`
+	Trigger             string              `json:"trigger,omitempty"`
+	Partitions          int                 `json:"partitions,omitempty"`
+	PartitionBy         string              `json:"partition_by,omitempty"`
+	Returning           bool                `json:"returning,omitempty"`
+	RebuildNs           int64               `json:"rebuild_ns,omitempty"`
+	RebuildRowsPerSec   float64             `json:"rebuild_rows_per_sec,omitempty"`
+	RowsPerSec          float64             `json:"rows_per_sec"`
+	StdDev              float64             `json:"std_dev"`
+	CI95                float64             `json:"ci95"`
+	BootstrapCILow      float64             `json:"bootstrap_ci_low,omitempty"`
+	BootstrapCIHigh     float64             `json:"bootstrap_ci_high,omitempty"`
+	MinRowsPerSec       float64             `json:"min_rows_per_sec"`
+	MaxRowsPerSec       float64             `json:"max_rows_per_sec"`
+	MedianRowsPerSec    float64             `json:"median_rows_per_sec"`
+	BytesPerSec         float64             `json:"bytes_per_sec"`
+	WALBytesPerRow      float64             `json:"wal_bytes_per_row"`
+	WALBytesPerSec      float64             `json:"wal_bytes_per_sec"`
+	TableBytes          int64               `json:"table_bytes"`
+	HeapBytes           int64               `json:"heap_bytes"`
+	IndexBytes          int64               `json:"index_bytes"`
+	HeapBytesPerRow     float64             `json:"heap_bytes_per_row"`
+	IndexBytesPerRow    float64             `json:"index_bytes_per_row"`
+	TableBytesBySample  []int64             `json:"table_bytes_by_sample,omitempty"`
+	Samples             int                 `json:"samples"`
+	Rejected            int                 `json:"rejected_samples"`
+	Retries             int                 `json:"retries"`
+	Converged           bool                `json:"converged"`
+	FixedSamples        bool                `json:"fixed_samples,omitempty"`
+	DurationNs          int64               `json:"duration_ns"`
+	LatencyP50          int64               `json:"latency_p50_ns"`
+	LatencyP90          int64               `json:"latency_p90_ns"`
+	LatencyP95          int64               `json:"latency_p95_ns"`
+	LatencyP99          int64               `json:"latency_p99_ns"`
+	TargetRate          float64             `json:"target_rate,omitempty"`
+	LagP50              int64               `json:"lag_p50_ns,omitempty"`
+	LagP99              int64               `json:"lag_p99_ns,omitempty"`
+	StartRows           []int               `json:"start_rows,omitempty"`
+	Explain             *jsonExplain        `json:"explain,omitempty"`
+	Allocs              *jsonAllocs         `json:"allocs,omitempty"`
+	ServerTiming        *jsonTxTiming       `json:"server_timing,omitempty"`
+	PGStats             *jsonPGStats        `json:"pg_stats,omitempty"`
+	WorkerRowsPerSec    []float64           `json:"worker_rows_per_sec,omitempty"`
+	SeedRows            int                 `json:"seed_rows,omitempty"`
+	SeedNs              int64               `json:"seed_ns,omitempty"`
+	LatencyBuckets      []jsonLatencyBucket `json:"latency_buckets"`
+}
+
+type jsonExplain struct {
+	Rows        int   `json:"rows"`
+	PlanningNs  int64 `json:"planning_ns"`
+	ExecutionNs int64 `json:"execution_ns"`
+	SharedHit   int64 `json:"shared_hit_blocks"`
+	SharedRead  int64 `json:"shared_read_blocks"`
+	SharedDirty int64 `json:"shared_dirtied_blocks"`
+}
+
+type jsonAllocs struct {
+	BytesPerRow      float64 `json:"bytes_per_row"`
+	AllocsPerRow     float64 `json:"allocs_per_row"`
+	GCsPerMillionRow float64 `json:"gcs_per_million_rows"`
+}
+
+type jsonPGStats struct {
+	BlocksRead int64             `json:"blocks_read"`
+	BlocksHit  int64             `json:"blocks_hit"`
+	IOTimeNs   int64             `json:"io_time_ns"`
+	Statements *jsonPGStatements `json:"statements,omitempty"`
+}
+
+type jsonPGStatements struct {
+	BlocksRead int64 `json:"blocks_read"`
+	BlocksHit  int64 `json:"blocks_hit"`
+	IOTimeNs   int64 `json:"io_time_ns"`
+}
+
+type jsonLatencyBucket struct {
+	UpperMicros int64 `json:"le_us"`
+	Count       int   `json:"count"`
+}
+
+// writeOutput writes results to the -output file, or to stdout when no path
+// is given. CSV output is appended to an existing file, as long as its
+// header names the same columns; other formats replace it.
+func writeOutput(cfg config, info runInfo, results []Result) error {
+	if cfg.output == "" {
+		return writeResults(os.Stdout, cfg.format, info, results, false)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	appending := false
+	if cfg.format == formatCSV {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if info, err := os.Stat(cfg.output); err == nil && info.Size() > 0 {
+			if err := checkCSVHeader(cfg.output, csvHeaderFor(results)); err != nil {
+				return err
+			}
+			appending = true
+		}
+	}
+
+	f, err := os.OpenFile(cfg.output, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := writeResults(f, cfg.format, info, results, appending); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// csvHeaderFor returns the header row of results in CSV: the matrix's when
+// several worker counts were measured, writeCSV's otherwise.
+func csvHeaderFor(results []Result) []string {
+	if _, workerCounts := matrixAxes(results); len(workerCounts) > 1 {
+		return matrixCSVHeader(workerCounts)
+	}
+	return csvHeader
+}
+
+// checkCSVHeader verifies that the CSV file at path, written by an earlier
+// run, has the header row want. The metadata comments before it are
+// skipped.
+func checkCSVHeader(path string, want []string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	got, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read the header of %s: %w", path, err)
+	}
+	if !slices.Equal(got, want) {
+		return fmt.Errorf("cannot append to %s: its columns %v differ from %v written by this run", path, got, want)
+	}
+	return nil
+}
+
+// writeResults renders results to w in the requested format. When appending
+// is set, formats with a header row omit it.
+func writeResults(w io.Writer, format string, info runInfo, results []Result, appending bool) error {
+	switch format {
+	case formatText:
+		for _, s := range info.servers {
+			displayServer(w, s)
+			displayOverhead(w, s.overhead)
+		}
+		displayHistogram(w, results)
+		displayCrossover(w, results)
+		displayCommitNote(w, info.servers, results)
+		displaySavepointOverhead(w, results)
+		displayForeignKeyCost(w, results)
+		displayTriggerOverhead(w, results)
+		displayPartitionOverhead(w, results)
+		displayReturningOverhead(w, results)
+		displayTiming(w, info.elapsed, info.phases)
+		return nil
+	case formatJSON:
+		return writeJSON(w, info, results)
+	case formatBenchmark:
+		return writeBenchmark(w, info, results)
+	case formatCSV:
+		if !appending {
+			if err := writeCSVMetadata(w, info); err != nil {
+				return err
+			}
+		}
+		if batchSizes, workerCounts := matrixAxes(results); len(workerCounts) > 1 {
+			return writeMatrixCSV(w, results, batchSizes, workerCounts, !appending)
+		}
+		return writeCSV(w, results, !appending)
+	case formatMarkdown:
+		return writeMarkdown(w, info, results)
+	case formatHTML:
+		return writeHTML(w, info, results)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func writeJSON(w io.Writer, info runInfo, results []Result) error {
+	out := jsonOutput{Metadata: toJSONMetadata(info), Results: make([]jsonResult, 0, len(results))}
+	for _, r := range results {
+		out.Results = append(out.Results, toJSONResult(r))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func toJSONResult(r Result) jsonResult {
+	out := jsonResult{
+		Op:                  r.op,
+		Mix:                 r.mix,
+		Method:              r.method,
+		BatchSize:           r.batchSize,
+		TxSize:              r.txSize,
+		Workers:             r.workers,
+		TableType:           r.tableType,
+		ExecMode:            r.execMode,
+		PipelineDepth:       r.pipeline,
+		RunOrder:            r.order,
+		Ordering:            r.ordering,
+		BlobSize:            r.blobSize,
+		Server:              r.server,
+		SecondaryIndexes:    r.indexes,
+		IndexesRebuilt:      r.rebuilt,
+		AsyncCommit:         r.asyncCommit,
+		Speedup:             r.speedup,
+		SavepointEvery:      r.savepoint,
+		ForeignKeys:         r.foreignKeys,
+		ForeignKeysEnforced: r.fkEnforced,
+		Trigger:             r.trigger,
+		Partitions:          r.partitions,
+		PartitionBy:         r.partitionBy,
+		Returning:           r.returning,
+		RowsPerSec:          r.rowsPerSec,
+		StdDev:              r.stdDev,
+		CI95:                r.ci95,
+		BootstrapCILow:      r.bootLo,
+		BootstrapCIHigh:     r.bootHi,
+		MinRowsPerSec:       r.minRate,
+		MaxRowsPerSec:       r.maxRate,
+		MedianRowsPerSec:    r.medianRate,
+		BytesPerSec:         r.bytesPerSec,
+		WALBytesPerRow:      r.walPerRow,
+		WALBytesPerSec:      r.walPerSec,
+		TableBytes:          r.size.total,
+		HeapBytes:           r.size.heap,
+		IndexBytes:          r.size.indexes,
+		HeapBytesPerRow:     r.size.heapPerRow(),
+		IndexBytesPerRow:    r.size.indexesPerRow(),
+		TableBytesBySample:  r.sizes,
+		Samples:             r.samples,
+		Rejected:            r.rejected,
+		Retries:             r.retries,
+		Converged:           r.converged,
+		FixedSamples:        r.fixed,
+		DurationNs:          r.duration.Nanoseconds(),
+		LatencyP50:          r.latency.p50.Nanoseconds(),
+		LatencyP90:          r.latency.p90.Nanoseconds(),
+		LatencyP95:          r.latency.p95.Nanoseconds(),
+		LatencyP99:          r.latency.p99.Nanoseconds(),
+		TargetRate:          r.targetRate,
+		LagP50:              r.lag.p50.Nanoseconds(),
+		LagP99:              r.lag.p99.Nanoseconds(),
+		StartRows:           r.startRows,
+		WorkerRowsPerSec:    r.workerRates,
+		SeedRows:            r.seedRows,
+		SeedNs:              r.seeding.Nanoseconds(),
+		LatencyBuckets:      jsonBuckets(r.buckets),
+	}
+	if p := r.pgStats; p != nil {
+		out.PGStats = &jsonPGStats{
+			BlocksRead: p.blksRead,
+			BlocksHit:  p.blksHit,
+			IOTimeNs:   p.ioTime.Nanoseconds(),
+		}
+		if p.statements {
+			out.PGStats.Statements = &jsonPGStatements{
+				BlocksRead: p.stmtBlksRead,
+				BlocksHit:  p.stmtBlksHit,
+				IOTimeNs:   p.stmtIOTime.Nanoseconds(),
+			}
+		}
+	}
+	if e := r.explain; e.runs > 0 {
+		out.Explain = &jsonExplain{
+			Rows:        e.rows,
+			PlanningNs:  e.planning.Nanoseconds(),
+			ExecutionNs: e.execution.Nanoseconds(),
+			SharedHit:   e.sharedHit,
+			SharedRead:  e.sharedRead,
+			SharedDirty: e.sharedDirty,
+		}
+	}
+	if t := r.txTiming; t.txs > 0 {
+		out.ServerTiming = &jsonTxTiming{
+			Transactions: t.txs,
+			ClientNs:     t.client.Nanoseconds(),
+			ServerNs:     t.server.Nanoseconds(),
+			OverheadTxNs: t.overheadPerTx().Nanoseconds(),
+		}
+	}
+	if a := r.allocs; a.rows > 0 {
+		out.Allocs = &jsonAllocs{BytesPerRow: a.bytesPerRow(), AllocsPerRow: a.allocsPerRow(), GCsPerMillionRow: a.gcsPerMillion()}
+	}
+	if r.rebuilt {
+		out.RebuildNs = r.rebuild.Nanoseconds()
+		out.RebuildRowsPerSec = r.rebuildRate
+	}
+	return out
+}
+
+func jsonBuckets(buckets []latencyBucket) []jsonLatencyBucket {
+	out := make([]jsonLatencyBucket, len(buckets))
+	for i, b := range buckets {
+		out[i] = jsonLatencyBucket{UpperMicros: b.upperMicros, Count: b.count}
+	}
+	return out
+}
+
+// writeBenchmark emits results in the Go benchmark format understood by
+// benchstat. Each row inserted counts as one operation. The run's metadata
+// is written as configuration lines, which benchstat can group by.
+func writeBenchmark(w io.Writer, info runInfo, results []Result) error {
+	if _, err := fmt.Fprintf(w, "goos: %s\ngoarch: %s\npkg: github.com/perbu/pscale\n", runtime.GOOS, runtime.GOARCH); err != nil {
+		return err
+	}
+	for _, kv := range metadataLines(info) {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	procs := runtime.GOMAXPROCS(0)
+	for _, r := range results {
+		nsPerRow := float64(0)
+		if r.rowsPerSec > 0 {
+			nsPerRow = 1e9 / r.rowsPerSec
+		}
+		_, err := fmt.Fprintf(w, "%s-%d\t%d\t%.1f ns/op\t%.2f MB/s\t%.0f rows/s\n",
+			benchmarkName(r), procs, r.rows, nsPerRow, r.bytesPerSec/1e6, r.rowsPerSec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchmarkName builds a benchstat-compatible name from the parameters
+// that distinguish a result.
+func benchmarkName(r Result) string {
+	name := "BenchmarkInsert"
+	if r.op != opInsert {
+		name = "Benchmark" + strings.ToUpper(r.op[:1]) + r.op[1:]
+	}
+	parts := []string{name, "method=" + r.method, fmt.Sprintf("batch=%d", r.batchSize)}
+	if r.txSize != r.batchSize {
+		parts = append(parts, fmt.Sprintf("tx=%d", r.txSize))
+	}
+	if r.workers > 1 {
+		parts = append(parts, fmt.Sprintf("workers=%d", r.workers))
+	}
+	if r.tableType != tableLogged {
+		parts = append(parts, "table="+r.tableType)
+	}
+	if r.execMode != execCacheStatement {
+		parts = append(parts, "exec="+r.execMode)
+	}
+	if r.pipeline > 0 {
+		parts = append(parts, fmt.Sprintf("depth=%d", r.pipeline))
+	}
+	if r.server != "" {
+		// Slashes would start a sub-benchmark
+		parts = append(parts, "server="+strings.ReplaceAll(r.server, "/", "_"))
+	}
+	if r.indexes > 0 {
+		parts = append(parts, fmt.Sprintf("indexes=%d", r.indexes))
+	}
+	if r.rebuilt {
+		parts = append(parts, "rebuilt")
+	}
+	if r.asyncCommit {
+		parts = append(parts, "async")
+	}
+	if r.savepoint > 0 {
+		parts = append(parts, fmt.Sprintf("savepoint=%d", r.savepoint))
+	}
+	if r.fkEnforced {
+		parts = append(parts, fmt.Sprintf("fk=%d", r.foreignKeys))
+	}
+	if r.trigger != triggerNone {
+		parts = append(parts, "trigger="+r.trigger)
+	}
+	if r.partitions > 0 {
+		parts = append(parts, fmt.Sprintf("partitions=%d", r.partitions), "by="+r.partitionBy)
+	}
+	if r.returning {
+		parts = append(parts, "returning")
+	}
+	return strings.Join(parts, "/")
+}
+
+// writeCSVMetadata writes the run's metadata as "# key: value" comment
+// lines, which readers such as Go's encoding/csv can be told to skip.
+func writeCSVMetadata(w io.Writer, info runInfo) error {
+	for _, kv := range metadataLines(info) {
+		if _, err := fmt.Fprintf(w, "# %s: %s\n", kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvHeader names the columns of writeCSV.
+var csvHeader = []string{
+	"op", "method", "workers", "server", "batch_size", "tx_size", "variant",
+	"async_commit", "savepoint_every", "foreign_keys", "foreign_keys_enforced",
+	"trigger", "partitions", "partition_by", "returning",
+	"rows_per_sec", "std_dev", "cv_percent", "samples", "speedup",
+}
+
+// writeCSV writes one line per result, preceded by a header row if header
+// is set. Numbers use fixed precision so that files diff cleanly.
+func writeCSV(w io.Writer, results []Result, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	for _, r := range results {
+		cv := 0.0
+		if r.rowsPerSec > 0 {
+			cv = r.stdDev / r.rowsPerSec * 100
+		}
+		record := []string{
+			r.op,
+			r.method,
+			strconv.Itoa(r.workers),
+			r.server,
+			strconv.Itoa(r.batchSize),
+			strconv.Itoa(r.txSize),
+			variantLabel(r.params()),
+			strconv.FormatBool(r.asyncCommit),
+			strconv.Itoa(r.savepoint),
+			strconv.Itoa(r.foreignKeys),
+			strconv.FormatBool(r.fkEnforced),
+			r.trigger,
+			strconv.Itoa(r.partitions),
+			r.partitionBy,
+			strconv.FormatBool(r.returning),
+			strconv.FormatFloat(r.rowsPerSec, 'f', 2, 64),
+			strconv.FormatFloat(r.stdDev, 'f', 2, 64),
+			strconv.FormatFloat(cv, 'f', 2, 64),
+			strconv.Itoa(r.samples),
+			strconv.FormatFloat(r.speedup, 'f', 2, 64),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeMarkdown writes results as a GitHub-flavored Markdown table, preceded
+// by an HTML comment recording the run's metadata and the server it ran
+// against.
+func writeMarkdown(w io.Writer, info runInfo, results []Result) error {
+	var b strings.Builder
+	b.WriteString("<!--\n")
+	for _, kv := range metadataLines(info) {
+		fmt.Fprintf(&b, "%s: %s\n", kv[0], kv[1])
+	}
+	for _, server := range info.servers {
+		if server.name != "" {
+			fmt.Fprintf(&b, "server: %s\n", server.name)
+		}
+		fmt.Fprintf(&b, "server_version: %s\n", server.serverVersion)
+		fmt.Fprintf(&b, "transport: %s\n", server.transport)
+		for _, s := range server.settings {
+			fmt.Fprintf(&b, "%s: %s\n", s.name, s.value)
+		}
+	}
+	b.WriteString("-->\n\n")
+	if info.label != "" {
+		fmt.Fprintf(&b, "**%s**\n\n", info.label)
+	}
+	b.WriteString("| Batch size | Rows/sec | ± Std dev | CV % | Samples | Speedup |\n")
+	b.WriteString("|-----------:|---------:|----------:|-----:|--------:|--------:|\n")
+	labels := newLabeler(results)
+	for _, r := range groupByParameters(results) {
+		cv := 0.0
+		if r.rowsPerSec > 0 {
+			cv = r.stdDev / r.rowsPerSec * 100
+		}
+		fmt.Fprintf(&b, "| %s | %.0f | %.0f | %.1f | %d | %.1f× |\n", labels.label(r), r.rowsPerSec, r.stdDev, cv, r.samples, r.speedup)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// matrixCSVHeader names the columns of writeMatrixCSV.
+func matrixCSVHeader(workerCounts []int) []string {
+	header := []string{"method", "server", "variant", "batch_size"}
+	for _, workers := range workerCounts {
+		header = append(header, fmt.Sprintf("workers_%d", workers))
+	}
+	return header
+}
+
+// writeMatrixCSV writes rows/sec as a grid with one line per method, server,
+// variant and batch size and one column per worker count. Combinations that weren't
+// measured are left empty.
+func writeMatrixCSV(w io.Writer, results []Result, batchSizes, workerCounts []int, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write(matrixCSVHeader(workerCounts)); err != nil {
+			return err
+		}
+	}
+	for _, panel := range matrixPanels(results) {
+		for _, batchSize := range batchSizes {
+			record := []string{panel.params.method, panel.server, variantLabel(panel.params), strconv.Itoa(batchSize)}
+			for _, workers := range workerCounts {
+				cell := ""
+				if r, ok := matrixLookup(results, panel, batchSize, workers); ok {
+					cell = strconv.FormatFloat(r.rowsPerSec, 'f', 2, 64)
+				}
+				record = append(record, cell)
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
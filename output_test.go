@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// variantResults returns results measured with the same batch sizes and
+// workers, once plainly and once with the indexes rebuilt.
+func variantResults() []Result {
+	var results []Result
+	for _, rebuilt := range []bool{false, true} {
+		for _, workers := range []int{1, 2} {
+			rate := float64(1000 * workers)
+			if rebuilt {
+				rate *= 3
+			}
+			results = append(results, Result{
+				op: opInsert, method: methodBatch, batchSize: 100, txSize: 100, workers: workers,
+				trigger: triggerNone, rebuilt: rebuilt, rowsPerSec: rate, samples: 5,
+			})
+		}
+	}
+	return results
+}
+
+func readCSV(t *testing.T, s string) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(s)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestWriteCSVTellsVariantsApart(t *testing.T) {
+	var b strings.Builder
+	if err := writeCSV(&b, variantResults(), true); err != nil {
+		t.Fatal(err)
+	}
+	records := readCSV(t, b.String())
+	header, rows := records[0], records[1:]
+
+	seen := map[string]bool{}
+	for _, row := range rows {
+		key := strings.Join(row[:len(header)-5], ",") // Every column but the measurements
+		if seen[key] {
+			t.Errorf("two rows share the parameters %s", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestMatrixKeepsVariants(t *testing.T) {
+	results := variantResults()
+	panels := matrixPanels(results)
+	if len(panels) != 2 {
+		t.Fatalf("got %d panels, want one plain and one rebuilt", len(panels))
+	}
+	for _, r := range results {
+		got, ok := matrixLookup(results, panelOf(r), r.batchSize, r.workers)
+		if !ok || got.rowsPerSec != r.rowsPerSec {
+			t.Errorf("matrixLookup(%s) = %v rows/sec, want %v", resultLabel(r), got.rowsPerSec, r.rowsPerSec)
+		}
+	}
+
+	var b strings.Builder
+	if err := writeMatrixCSV(&b, results, []int{100}, []int{1, 2}, true); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"method", "server", "variant", "batch_size", "workers_1", "workers_2"},
+		{methodBatch, "", "", "100", "1000.00", "2000.00"},
+		{methodBatch, "", "rebuilt", "100", "3000.00", "6000.00"},
+	}
+	if got := readCSV(t, b.String()); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("writeMatrixCSV wrote %v, want %v", got, want)
+	}
+}
+
+func TestWriteCSVVariantColumns(t *testing.T) {
+	tests := []struct {
+		column string
+		set    func(*Result)
+		want   string
+	}{
+		{"async_commit", func(r *Result) { r.asyncCommit = true }, "true"},
+		{"savepoint_every", func(r *Result) { r.savepoint = 50 }, "50"},
+		{"foreign_keys_enforced", func(r *Result) { r.foreignKeys, r.fkEnforced = 2, true }, "true"},
+		{"trigger", func(r *Result) { r.trigger = triggerTimestamp }, triggerTimestamp},
+		{"partition_by", func(r *Result) { r.partitions, r.partitionBy = 4, partitionRange }, partitionRange},
+		{"returning", func(r *Result) { r.returning = true }, "true"},
+	}
+	for _, tt := range tests {
+		r := Result{op: opInsert, method: methodBatch, batchSize: 100, txSize: 100, workers: 1, trigger: triggerNone}
+		tt.set(&r)
+		var b strings.Builder
+		if err := writeCSV(&b, []Result{r}, true); err != nil {
+			t.Fatal(err)
+		}
+		records := readCSV(t, b.String())
+		i := slices.Index(records[0], tt.column)
+		if i < 0 {
+			t.Errorf("the header %v has no %s column", records[0], tt.column)
+			continue
+		}
+		if got := records[1][i]; got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCSVHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	content := "# pscale: v1\n# server: a, b\n" + strings.Join(csvHeader, ",") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCSVHeader(path, csvHeader); err != nil {
+		t.Errorf("checkCSVHeader rejected the matching header: %v", err)
+	}
+	// A file written before the variant columns were added
+	old := []string{"batch_size", "rows_per_sec", "std_dev", "cv_percent", "samples", "speedup"}
+	if err := os.WriteFile(path, []byte(strings.Join(old, ",")+"\n100,1,2,3,4,5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCSVHeader(path, csvHeader); err == nil {
+		t.Errorf("checkCSVHeader accepted the header %v", old)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// overheadResult summarizes the timing of one fixed per-transaction cost.
+type overheadResult struct {
+	name       string
+	iterations int
+	mean       time.Duration
+	stdDev     time.Duration
+	latency    latencyPercentiles
+}
+
+// measureOverhead times the costs every insert transaction pays regardless
+// of its rows: opening a new connection, acquiring a pooled one, and
+// beginning and committing an empty transaction.
+func measureOverhead(ctx context.Context, pool *pgxpool.Pool, txOptions pgx.TxOptions, iterations int) ([]overheadResult, error) {
+	fmt.Fprintf(progress, "Measuring connection and transaction overhead over %d iterations...\n", iterations)
+
+	connConfig := pool.Config().ConnConfig
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"connect", func() error {
+			conn, err := pgx.ConnectConfig(ctx, connConfig)
+			if err != nil {
+				return err
+			}
+			return conn.Close(ctx)
+		}},
+		{"acquire", func() error {
+			conn, err := pool.Acquire(ctx)
+			if err != nil {
+				return err
+			}
+			conn.Release()
+			return nil
+		}},
+		{"begin+commit", func() error {
+			tx, err := pool.BeginTx(ctx, txOptions)
+			if err != nil {
+				return err
+			}
+			return tx.Commit(ctx)
+		}},
+	}
+
+	results := make([]overheadResult, 0, len(steps))
+	for _, step := range steps {
+		timings := make([]time.Duration, iterations)
+		for i := range timings {
+			start := time.Now()
+			if err := step.run(); err != nil {
+				return nil, fmt.Errorf("failed to measure %s: %w", step.name, err)
+			}
+			timings[i] = time.Since(start)
+		}
+		results = append(results, summarizeOverhead(step.name, timings))
+	}
+	return results, nil
+}
+
+func summarizeOverhead(name string, timings []time.Duration) overheadResult {
+	values := make([]float64, len(timings))
+	for i, t := range timings {
+		values[i] = float64(t)
+	}
+	mean := calculateMean(values)
+	return overheadResult{
+		name:       name,
+		iterations: len(timings),
+		mean:       time.Duration(mean),
+		stdDev:     time.Duration(calculateStdDev(values, mean)),
+		latency:    calculateLatencyPercentiles(timings),
+	}
+}
+
+// displayOverhead prints one line per measured overhead.
+func displayOverhead(w io.Writer, results []overheadResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "=== Per-transaction Overhead ===")
+	fmt.Fprintln(w)
+	for _, r := range results {
+		fmt.Fprintf(w, "%-12s | mean %v ± %v, p50=%v p99=%v (n=%d)\n", r.name,
+			r.mean.Round(time.Microsecond), r.stdDev.Round(time.Microsecond),
+			r.latency.p50.Round(time.Microsecond), r.latency.p99.Round(time.Microsecond), r.iterations)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Values of -partition-by.
+const (
+	partitionHash  = "hash"
+	partitionRange = "range"
+)
+
+// partitionedTable names the partitioned copy of table measured under
+// -partitions, in the same schema.
+func partitionedTable(table string) string {
+	return table + "_part"
+}
+
+// createPartitionedTable recreates part as a copy of table's columns,
+// defaults and indexes, partitioned on id into n partitions by hash or,
+// with by set to partitionRange, by range. Serial keys get a sequence of
+// their own, which clearTable restarts, so that every sample spreads its
+// sampleRows keys over the same range partitions; keys past the last
+// bound, as when the table grows with -no-truncate, land in a default
+// partition. UUID keys are split over the whole key space, which random
+// UUIDs spread evenly but time-ordered ones fill one partition at a time.
+func createPartitionedTable(ctx context.Context, pool *pgxpool.Pool, table, part pgx.Identifier, by string, n int, serial bool, sampleRows int) error {
+	stmts := []string{
+		"DROP TABLE IF EXISTS " + part.Sanitize() + " CASCADE",
+		"CREATE TABLE " + part.Sanitize() + " (LIKE " + table.Sanitize() + " INCLUDING ALL) PARTITION BY " + strings.ToUpper(by) + " (id)",
+	}
+	if serial {
+		seq := child(part, "id_seq")
+		stmts = append(stmts,
+			"CREATE SEQUENCE "+seq.Sanitize()+" OWNED BY "+part.Sanitize()+".id",
+			"ALTER TABLE "+part.Sanitize()+" ALTER COLUMN id SET DEFAULT nextval('"+strings.ReplaceAll(seq.Sanitize(), "'", "''")+"')")
+	}
+	for i := 0; i < n; i++ {
+		var bounds string
+		switch {
+		case by == partitionHash:
+			bounds = fmt.Sprintf("WITH (MODULUS %d, REMAINDER %d)", n, i)
+		case serial:
+			width := (sampleRows + n - 1) / n
+			bounds = fmt.Sprintf("FROM (%d) TO (%d)", 1+i*width, 1+(i+1)*width)
+		default:
+			bounds = fmt.Sprintf("FROM (%s) TO (%s)", uuidBound(i, n), uuidBound(i+1, n))
+		}
+		stmts = append(stmts, "CREATE TABLE "+child(part, fmt.Sprintf("p%d", i+1)).Sanitize()+
+			" PARTITION OF "+part.Sanitize()+" FOR VALUES "+bounds)
+	}
+	if by == partitionRange && serial {
+		stmts = append(stmts, "CREATE TABLE "+child(part, "default").Sanitize()+" PARTITION OF "+part.Sanitize()+" DEFAULT")
+	}
+
+	for _, sql := range stmts {
+		if _, err := pool.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("failed to create partitioned table: %w", err)
+		}
+	}
+	return nil
+}
+
+// child names an object belonging to table, in its schema.
+func child(table pgx.Identifier, suffix string) pgx.Identifier {
+	name := slices.Clone(table)
+	name[len(name)-1] += "_" + suffix
+	return name
+}
+
+// uuidBound returns the ith of n range bounds splitting the UUID key
+// space on its first 32 bits, with the outermost ones open.
+func uuidBound(i, n int) string {
+	switch i {
+	case 0:
+		return "MINVALUE"
+	case n:
+		return "MAXVALUE"
+	}
+	prefix := uint64(i) * (math.MaxUint32 + 1) / uint64(n)
+	return fmt.Sprintf("'%08x-0000-0000-0000-000000000000'", prefix)
+}
+
+// displayPartitionOverhead prints, for each result measured on the
+// -partitions table, how its throughput compares with the same run on the
+// unpartitioned table.
+func displayPartitionOverhead(w io.Writer, results []Result) {
+	isVariant := func(r Result) bool { return r.partitions > 0 }
+	heading := func(r Result) string {
+		return fmt.Sprintf("Partitioning overhead (%d %s partitions):", r.partitions, r.partitionBy)
+	}
+	displaySlowdown(w, results, isVariant, heading, func(p *runParams) { p.partitions = 0 })
+}
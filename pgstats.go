@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pgStats is the server's own I/O accounting, read from pg_stat_database
+// for the whole database and, when the extension is loaded, from
+// pg_stat_statements for the statements naming the benchmark table. Read
+// before and after a sample, the difference is what the sample cost.
+type pgStats struct {
+	blksRead, blksHit int64
+	ioTime            time.Duration // blk_read_time + blk_write_time, which needs track_io_timing
+
+	statements                bool // Whether the statement counters were read
+	stmtBlksRead, stmtBlksHit int64
+	stmtIOTime                time.Duration
+}
+
+// sub returns the counters of s less those of before.
+func (s pgStats) sub(before pgStats) pgStats {
+	return pgStats{
+		blksRead:     s.blksRead - before.blksRead,
+		blksHit:      s.blksHit - before.blksHit,
+		ioTime:       s.ioTime - before.ioTime,
+		statements:   s.statements,
+		stmtBlksRead: s.stmtBlksRead - before.stmtBlksRead,
+		stmtBlksHit:  s.stmtBlksHit - before.stmtBlksHit,
+		stmtIOTime:   s.stmtIOTime - before.stmtIOTime,
+	}
+}
+
+// add accumulates the counters of other into s.
+func (s *pgStats) add(other pgStats) {
+	s.blksRead += other.blksRead
+	s.blksHit += other.blksHit
+	s.ioTime += other.ioTime
+	s.statements = other.statements
+	s.stmtBlksRead += other.stmtBlksRead
+	s.stmtBlksHit += other.stmtBlksHit
+	s.stmtIOTime += other.stmtIOTime
+}
+
+// hitRatio returns the share of block requests served from shared buffers.
+func hitRatio(hit, read int64) float64 {
+	if hit+read == 0 {
+		return 0
+	}
+	return float64(hit) / float64(hit+read)
+}
+
+// hasStatementStats reports whether pg_stat_statements can be queried. A
+// server without it is only warned about, since pg_stat_database still
+// gives the database's totals.
+func hasStatementStats(ctx context.Context, pool *pgxpool.Pool) bool {
+	_, err := pool.Exec(ctx, "SELECT 1 FROM pg_stat_statements LIMIT 1")
+	if err != nil {
+		slog.Warn("pg_stat_statements is not available, reporting database totals only", "err", err)
+		return false
+	}
+	return true
+}
+
+// readPGStats reads the current counters. The statistics snapshot is
+// cleared first, since a transaction would otherwise keep seeing the ones
+// it read first, and the server only publishes a backend's counters once
+// in a while, so short samples are attributed roughly at best.
+func readPGStats(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, statements bool) (pgStats, error) {
+	var s pgStats
+	var ioMillis float64
+	if _, err := pool.Exec(ctx, "SELECT pg_stat_clear_snapshot()"); err != nil {
+		return pgStats{}, fmt.Errorf("failed to read pg_stat_database: %w", err)
+	}
+	err := pool.QueryRow(ctx, `SELECT blks_read, blks_hit, blk_read_time + blk_write_time
+		FROM pg_stat_database WHERE datname = current_database()`).Scan(&s.blksRead, &s.blksHit, &ioMillis)
+	if err != nil {
+		return pgStats{}, fmt.Errorf("failed to read pg_stat_database: %w", err)
+	}
+	s.ioTime = time.Duration(ioMillis * float64(time.Millisecond))
+	if !statements {
+		return s, nil
+	}
+
+	// The I/O timing columns were renamed in PostgreSQL 17, so they are
+	// read by either name through the row's JSON form
+	err = pool.QueryRow(ctx, `SELECT coalesce(sum(shared_blks_read), 0)::bigint, coalesce(sum(shared_blks_hit), 0)::bigint,
+			coalesce(sum(coalesce((to_jsonb(s)->>'blk_read_time')::float8, (to_jsonb(s)->>'shared_blk_read_time')::float8, 0) +
+				coalesce((to_jsonb(s)->>'blk_write_time')::float8, (to_jsonb(s)->>'shared_blk_write_time')::float8, 0)), 0)
+		FROM pg_stat_statements s
+		WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database()) AND strpos(query, $1) > 0`,
+		table.Sanitize()).Scan(&s.stmtBlksRead, &s.stmtBlksHit, &ioMillis)
+	if err != nil {
+		return pgStats{}, fmt.Errorf("failed to read pg_stat_statements: %w", err)
+	}
+	s.statements = true
+	s.stmtIOTime = time.Duration(ioMillis * float64(time.Millisecond))
+	return s, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+)
+
+// runPingCommand implements "pscale ping [-dsn=...] [-count=N]": it
+// connects, reports the server version and transport and the round-trip
+// time of SELECT 1, without running migrations or touching the table.
+func runPingCommand(args []string) {
+	fs := flag.NewFlagSet("ping", flag.ContinueOnError)
+	dsn := fs.String("dsn", "", "database connection string (overrides DATABASE_URL)")
+	count := fs.Int("count", 10, "number of round-trips to time")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pscale ping [-dsn=...] [-count=N]")
+		fs.PrintDefaults()
+	}
+	parseCommandFlags(fs, args, func() bool { return fs.NArg() == 0 && *count > 0 })
+
+	_ = godotenv.Load()
+	connString, err := resolveDSN(*dsn)
+	if err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	if err := ping(context.Background(), os.Stdout, connString, *count); err != nil {
+		fatal("ping failed", "err", err)
+	}
+}
+
+// ping connects to the server at connString and times count round-trips
+// of SELECT 1 on one connection, after a first one that connects it.
+func ping(ctx context.Context, w io.Writer, connString string, count int) error {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return fmt.Errorf("invalid connection string: %w", err)
+	}
+	poolConfig.MaxConns = 1
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %w", err)
+	}
+	defer pool.Close()
+
+	var version string
+	if err := pool.QueryRow(ctx, "SHOW server_version").Scan(&version); err != nil {
+		return err
+	}
+	transport, _, err := connTransport(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	timings := make([]time.Duration, count)
+	for i := range timings {
+		start := time.Now()
+		if _, err := pool.Exec(ctx, "SELECT 1"); err != nil {
+			return err
+		}
+		timings[i] = time.Since(start)
+	}
+	r := summarizeOverhead("ping", timings)
+
+	fmt.Fprintf(w, "%-20s %s\n", "host", poolConfig.ConnConfig.Host)
+	fmt.Fprintf(w, "%-20s %s\n", "server_version", version)
+	fmt.Fprintf(w, "%-20s %s\n", "transport", transport)
+	fmt.Fprintf(w, "%-20s mean %v ± %v, p50=%v p99=%v (n=%d)\n", "round-trip",
+		r.mean.Round(time.Microsecond), r.stdDev.Round(time.Microsecond),
+		r.latency.p50.Round(time.Microsecond), r.latency.p99.Round(time.Microsecond), r.iterations)
+	return nil
+}
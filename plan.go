@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unsafe"
+)
+
+// displayPlan prints what a run with cfg would do without connecting to
+// the database, for -dry-run. Row counts are ranges because steady-state
+// runs stop anywhere between -min-samples and -max-samples.
+func displayPlan(w io.Writer, cfg config, src rowSource) {
+	rowSize := averageRowSize(src)
+	sampleRows := min(cfg.sampleSize, src.Len())
+	combinations := len(cfg.methods) * len(cfg.workerCounts)
+	if cfg.rebuildIndexes {
+		combinations *= 2
+	}
+	if cfg.asyncCommit {
+		combinations *= 2
+	}
+	if cfg.savepointEvery > 0 {
+		combinations *= 2
+	}
+	if cfg.foreignKeys > 0 {
+		combinations *= 2
+	}
+	if cfg.trigger != triggerNone {
+		combinations *= 2
+	}
+	if cfg.partitions > 0 {
+		combinations *= 2
+	}
+	if cfg.returning {
+		combinations *= 2
+	}
+
+	fmt.Fprintln(w, "=== Plan ===")
+	fmt.Fprintln(w)
+	if cfg.op == opMix {
+		fmt.Fprintf(w, "%-20s %s (%s)\n", "op", cfg.op, cfg.mixRatio)
+	} else {
+		fmt.Fprintf(w, "%-20s %s\n", "op", cfg.op)
+	}
+	fmt.Fprintf(w, "%-20s %s\n", "methods", strings.Join(cfg.methods, ", "))
+	fmt.Fprintf(w, "%-20s %s\n", "batch sizes", (*intList)(&cfg.batchSizes).String())
+	displayValuesSplit(w, cfg)
+	fmt.Fprintf(w, "%-20s %s\n", "workers", (*intList)(&cfg.workerCounts).String())
+	fmt.Fprintf(w, "%-20s %s (%s)\n", "table", cfg.table, cfg.tableType)
+	fmt.Fprintf(w, "%-20s %s\n", "exec mode", cfg.execMode)
+	fmt.Fprintf(w, "%-20s %d, about %d bytes each\n", "total rows", src.Len(), rowSize)
+	if cfg.duration > 0 {
+		fmt.Fprintf(w, "%-20s %v per batch size\n", "duration", cfg.duration)
+	} else {
+		fmt.Fprintf(w, "%-20s %d rows, %d to %d samples per batch size\n", "samples", sampleRows, cfg.minSamples, cfg.maxSamples)
+	}
+
+	var minRows, maxRows, memory int
+	for _, batchSize := range cfg.batchSizes {
+		lo, hi := plannedRows(cfg, sampleRows, batchSize)
+		minRows += lo * combinations
+		maxRows += hi * combinations
+
+		// Each worker holds a batch, and the whole transaction when it may
+		// have to be replayed
+		opts := cfg.insertOptions(batchSize)
+		held := min(opts.batchSize, opts.txSize)
+		if opts.retries > 0 {
+			held += opts.txSize
+		}
+		perRow := rowSize + int(unsafe.Sizeof(TestRow{}))
+		memory = max(memory, held*perRow*slices.Max(cfg.workerCounts))
+	}
+	fmt.Fprintf(w, "%-20s about %.1f MB for buffered rows\n", "memory", float64(memory)/1e6)
+
+	switch {
+	case cfg.duration > 0 && cfg.targetRate == 0:
+		fmt.Fprintf(w, "%-20s unknown for a time-bounded run without -target-rate\n", "rows written")
+	case minRows == maxRows:
+		fmt.Fprintf(w, "%-20s %d, about %.1f MB\n", "rows written", maxRows, float64(maxRows*rowSize)/1e6)
+	default:
+		fmt.Fprintf(w, "%-20s %d to %d, about %.1f to %.1f MB\n", "rows written",
+			minRows, maxRows, float64(minRows*rowSize)/1e6, float64(maxRows*rowSize)/1e6)
+	}
+	fmt.Fprintln(w)
+}
+
+// displayConfig prints the configuration a run resolved from its flags,
+// defaults and environment, so that pasted results say what produced them.
+// Passwords in the connection strings are masked.
+func displayConfig(w io.Writer, cfg config, connStrings []string) {
+	fmt.Fprintln(w, "=== Configuration ===")
+	fmt.Fprintln(w)
+	for _, cs := range connStrings {
+		fmt.Fprintf(w, "%-20s %s\n", "dsn", redactDSN(cs))
+	}
+	if cfg.op == opMix {
+		fmt.Fprintf(w, "%-20s %s (%s)\n", "op", cfg.op, cfg.mixRatio)
+	} else {
+		fmt.Fprintf(w, "%-20s %s\n", "op", cfg.op)
+	}
+	fmt.Fprintf(w, "%-20s %s\n", "methods", strings.Join(cfg.methods, ", "))
+	fmt.Fprintf(w, "%-20s %s\n", "batch sizes", (*intList)(&cfg.batchSizes).String())
+	displayValuesSplit(w, cfg)
+	if cfg.txSize > 0 {
+		fmt.Fprintf(w, "%-20s %d\n", "tx size", cfg.txSize)
+	} else {
+		fmt.Fprintf(w, "%-20s the batch size\n", "tx size")
+	}
+	fmt.Fprintf(w, "%-20s %s\n", "workers", (*intList)(&cfg.workerCounts).String())
+	fmt.Fprintf(w, "%-20s %s, up to %d retries\n", "isolation", cfg.isolation, cfg.maxRetries)
+	fmt.Fprintf(w, "%-20s %s (%s, %s key, %d secondary indexes)\n", "table", cfg.table, cfg.tableType, cfg.pk, cfg.secondaryIndexes)
+	fmt.Fprintf(w, "%-20s %s\n", "exec mode", cfg.execMode)
+	switch {
+	case cfg.csvInput != "":
+		fmt.Fprintf(w, "%-20s %s\n", "rows", cfg.csvInput)
+	case cfg.randomData:
+		fmt.Fprintf(w, "%-20s %d random, %d%% compressible, seed %d\n", "rows", cfg.totalRows, cfg.compressibility, cfg.seed)
+	default:
+		fmt.Fprintf(w, "%-20s %d\n", "rows", cfg.totalRows)
+	}
+	if cfg.warmupMethod != "" {
+		fmt.Fprintf(w, "%-20s %d transactions with %s\n", "warmup", cfg.warmup, cfg.warmupMethod)
+	} else {
+		fmt.Fprintf(w, "%-20s %d transactions\n", "warmup", cfg.warmup)
+	}
+	switch {
+	case cfg.duration > 0:
+		fmt.Fprintf(w, "%-20s %v per batch size, target rate %g rows/sec\n", "duration", cfg.duration, cfg.targetRate)
+	case cfg.samples > 0:
+		fmt.Fprintf(w, "%-20s %d rows, exactly %d samples\n", "samples", cfg.sampleSize, cfg.samples)
+	default:
+		fmt.Fprintf(w, "%-20s %d rows, %d to %d samples\n", "samples", cfg.sampleSize, cfg.minSamples, cfg.maxSamples)
+		stable := fmt.Sprintf("CV below %g", cfg.targetCV)
+		if cfg.rejectOutliers {
+			stable += ", outliers rejected"
+		}
+		fmt.Fprintf(w, "%-20s %s\n", "stable when", stable)
+	}
+	if cfg.compare != "" {
+		fmt.Fprintf(w, "%-20s %s, regression above %g%%\n", "compare", cfg.compare, cfg.regressionThreshold)
+	}
+	fmt.Fprintln(w)
+}
+
+// displayValuesSplit notes that batches of the values method larger than
+// maxValuesRows are sent as several statements.
+func displayValuesSplit(w io.Writer, cfg config) {
+	limit := maxValuesRows(cfg.tableColumns())
+	if slices.Contains(cfg.methods, methodMultiValues) && slices.Max(cfg.batchSizes) > limit {
+		fmt.Fprintf(w, "%-20s split into statements of %d rows, the most that fit in %d parameters\n", "values batches", limit, maxBindParams)
+	}
+}
+
+// plannedRows returns the least and most rows written while measuring
+// one batch size, including warmup and any rows loaded beforehand.
+func plannedRows(cfg config, sampleRows, batchSize int) (lo, hi int) {
+	warmup := cfg.warmup * min(cfg.warmupSizeFor(batchSize), cfg.totalRows)
+	if cfg.duration > 0 {
+		n := cfg.seedRows + int(cfg.targetRate*cfg.duration.Seconds())
+		return warmup + n, warmup + n
+	}
+	lo, hi = cfg.minSamples*sampleRows, cfg.maxSamples*sampleRows
+	// The seed is loaded before each sample, unless the table grows
+	// across them
+	if cfg.noTruncate {
+		lo, hi = lo+cfg.seedRows, hi+cfg.seedRows
+	} else {
+		lo, hi = lo+cfg.minSamples*cfg.seedRows, hi+cfg.maxSamples*cfg.seedRows
+	}
+	switch cfg.op {
+	case opUpdate:
+		// The rows are loaded once and then updated in place
+		lo, hi = cfg.prepopulateRows, cfg.prepopulateRows
+	case opMix:
+		// The table is reloaded before every sample
+		lo, hi = lo+cfg.minSamples*cfg.prepopulateRows, hi+cfg.maxSamples*cfg.prepopulateRows
+	case opDelete:
+		// Every deleted row was loaded first
+		lo, hi = max(lo, cfg.prepopulateRows), max(hi, cfg.prepopulateRows)
+	}
+	return warmup + lo, warmup + hi
+}
+
+// averageRowSize estimates the size of a row from the first rows of src.
+func averageRowSize(src rowSource) int {
+	rows := src.Stream(0, min(src.Len(), 100))
+	defer rows.Close()
+	total, n := 0, 0
+	for row, ok := rows.Next(); ok; row, ok = rows.Next() {
+		total += row.size()
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / n
+}
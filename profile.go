@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// allocStats counts the heap allocations of the whole process while rows
+// were inserted, see -profile-allocs. They cover generating the rows and
+// encoding and sending them, which is what the client spends per row.
+type allocStats struct {
+	rows   int
+	bytes  uint64
+	allocs uint64
+	gcs    uint32
+}
+
+// add counts the allocations since before, made while inserting rows.
+func (a *allocStats) add(before *runtime.MemStats, rows int) {
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	a.rows += rows
+	a.bytes += after.TotalAlloc - before.TotalAlloc
+	a.allocs += after.Mallocs - before.Mallocs
+	a.gcs += after.NumGC - before.NumGC
+}
+
+func (a allocStats) bytesPerRow() float64  { return float64(a.bytes) / float64(a.rows) }
+func (a allocStats) allocsPerRow() float64 { return float64(a.allocs) / float64(a.rows) }
+func (a allocStats) gcsPerMillion() float64 {
+	return float64(a.gcs) / float64(a.rows) * 1e6
+}
+
+// startProfiling starts a CPU profile written to cpuPath, if set. The
+// returned function stops it and writes a heap profile to memPath, if set.
+func startProfiling(cpuPath, memPath string) (stop func() error, err error) {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		if cpuFile, err = os.Create(cpuPath); err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, err
+		}
+	}
+
+	return func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				return err
+			}
+		}
+		if memPath == "" {
+			return nil
+		}
+		f, err := os.Create(memPath)
+		if err != nil {
+			return err
+		}
+		// Collect garbage first so the profile shows live memory
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write heap profile: %w", err)
+		}
+		return f.Close()
+	}, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// rowsCommitted counts the rows committed by all workers since the program
+// started, so that progress can be reported while a sample is running.
+var rowsCommitted atomic.Int64
+
+// status draws the live progress line, or is nil when progress is not
+// being reported.
+var status *statusLine
+
+// statusLine is a progress writer for a terminal that can keep a single
+// status line at the bottom. Ordinary progress messages written to it
+// erase the status line first; it is redrawn on the next tick.
+type statusLine struct {
+	mu    sync.Mutex
+	w     io.Writer
+	tty   bool
+	shown bool
+}
+
+func newStatusLine(f *os.File) *statusLine {
+	return &statusLine{w: f, tty: isTerminal(f)}
+}
+
+// isTerminal reports whether f is an interactive terminal. Other character
+// devices, such as /dev/null, are not.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+func (s *statusLine) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLocked()
+	return s.w.Write(p)
+}
+
+// show replaces the status line with text. Without a terminal the text is
+// written as an ordinary line instead.
+func (s *statusLine) show(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.tty {
+		fmt.Fprintf(s.w, "    %s\n", text)
+		return
+	}
+	fmt.Fprintf(s.w, "\r\033[K    %s", text)
+	s.shown = true
+}
+
+func (s *statusLine) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLocked()
+}
+
+func (s *statusLine) clearLocked() {
+	if s.shown {
+		fmt.Fprint(s.w, "\r\033[K")
+		s.shown = false
+	}
+}
+
+// trackProgress reports the rows committed until the returned function is
+// called. When total is positive it is an upper bound on the rows to be
+// written and the ETA is estimated from it; otherwise it runs to deadline.
+// A terminal is updated several times a second; other outputs get a line
+// every ten seconds.
+func trackProgress(total int, deadline time.Time) (stop func()) {
+	if status == nil {
+		return func() {}
+	}
+
+	interval := 10 * time.Second
+	if status.tty {
+		interval = 250 * time.Millisecond
+	}
+	base := rowsCommitted.Load()
+	start := time.Now()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			rows := rowsCommitted.Load() - base
+			rate := float64(rows) / time.Since(start).Seconds()
+			eta := "unknown"
+			switch {
+			case total > 0 && rate > 0:
+				remaining := max(int64(total)-rows, 0)
+				eta = "≤ " + time.Duration(float64(remaining)/rate*float64(time.Second)).Round(time.Second).String()
+			case !deadline.IsZero():
+				eta = time.Until(deadline).Round(time.Second).String()
+			}
+			status.show(fmt.Sprintf("%d rows, %.0f rows/sec, ETA %s", rows, rate, eta))
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		status.clear()
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// scheduledTx is a transaction the open-loop scheduler wants started at a
+// given time.
+type scheduledTx struct {
+	offset   int
+	intended time.Time
+}
+
+// insertAtRate starts transactions of opts.txSize rows on a fixed schedule
+// that adds up to rate rows per second, until deadline passes, and hands
+// them to workers as they become free.
+//
+// The schedule is computed up front rather than taken from a time.Ticker,
+// which silently drops ticks while the workers fall behind. Each
+// transaction's latency is measured from when it was scheduled to start,
+// so time spent queueing behind slow transactions is counted instead of
+// omitted, and the delay before it actually started is reported as lag.
+func insertAtRate(ctx context.Context, ins Inserter, src rowSource, opts insertOptions, workers int, rate float64, deadline time.Time) (timedStats, error) {
+	n := min(opts.txSize, src.Len())
+	chunks := max(src.Len()/n, 1)
+	interval := time.Duration(float64(n) / rate * float64(time.Second))
+
+	perWorker := make([]timedStats, workers)
+	jobs := make(chan scheduledTx)
+	start := time.Now()
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(jobs)
+		for k := 0; ; k++ {
+			intended := start.Add(time.Duration(k) * interval)
+			if !intended.Before(deadline) {
+				return nil
+			}
+			t := time.NewTimer(time.Until(intended))
+			select {
+			case <-t.C:
+			case <-gctx.Done():
+				t.Stop()
+				return nil
+			}
+			select {
+			case jobs <- scheduledTx{offset: k % chunks * n, intended: intended}:
+			case <-gctx.Done():
+				return nil
+			}
+		}
+	})
+	for w := 0; w < workers; w++ {
+		g.Go(func() error {
+			ws := &perWorker[w]
+			for job := range jobs {
+				lag := time.Since(job.intended)
+				stats, err := insertRows(gctx, ins, src, job.offset, n, opts.batchSize)
+				if err != nil {
+					return err
+				}
+				stats.latencies = []time.Duration{time.Since(job.intended)}
+				ws.add(stats)
+				ws.lags = append(ws.lags, lag)
+				ws.txRates = append(ws.txRates, float64(stats.rows)/stats.elapsed.Seconds())
+			}
+			ws.elapsed = time.Since(start)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return timedStats{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return timedStats{}, err
+	}
+
+	var total timedStats
+	total.elapsed = time.Since(start)
+	for _, ws := range perWorker {
+		total.add(ws.insertStats)
+		total.txRates = append(total.txRates, ws.txRates...)
+		total.lags = append(total.lags, ws.lags...)
+		if workers > 1 {
+			total.workers = append(total.workers, workerStats{rows: ws.rows, elapsed: ws.elapsed})
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reportedSettings are the server settings recorded with every run because
+// they shape insert throughput.
+var reportedSettings = []string{"shared_buffers", "synchronous_commit", "max_wal_size", "wal_level"}
+
+// serverSetting is the value of one server setting.
+type serverSetting struct {
+	name, value string
+}
+
+// querySettings reads the server version and reportedSettings.
+func querySettings(ctx context.Context, pool *pgxpool.Pool) (version string, settings []serverSetting, err error) {
+	if err := pool.QueryRow(ctx, "SHOW server_version").Scan(&version); err != nil {
+		return "", nil, err
+	}
+	for _, name := range reportedSettings {
+		s := serverSetting{name: name}
+		if err := pool.QueryRow(ctx, "SHOW "+name).Scan(&s.value); err != nil {
+			return "", nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		settings = append(settings, s)
+	}
+	return version, settings, nil
+}
+
+// connTransport describes how the pool's connections reach the server: over
+// a unix socket or TCP, and with which TLS version and cipher suite if the
+// connection is encrypted. It inspects one connection, since they share a
+// configuration.
+func connTransport(ctx context.Context, pool *pgxpool.Pool) (transport string, encrypted bool, err error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	defer conn.Release()
+
+	netConn := conn.Conn().PgConn().Conn()
+	transport = netConn.RemoteAddr().Network()
+	if tlsConn, ok := netConn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		transport += fmt.Sprintf(", %s %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+		encrypted = true
+	}
+	return transport, encrypted, nil
+}
+
+// setting returns the value of the named setting, or "" if it wasn't read.
+func (info serverInfo) setting(name string) string {
+	for _, s := range info.settings {
+		if s.name == name {
+			return s.value
+		}
+	}
+	return ""
+}
+
+// displayServer prints the server version and settings as a header block.
+func displayServer(w io.Writer, info serverInfo) {
+	if info.name != "" {
+		fmt.Fprintf(w, "=== Server %s ===\n", info.name)
+	} else {
+		fmt.Fprintln(w, "=== Server ===")
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-20s %s\n", "server_version", info.serverVersion)
+	fmt.Fprintf(w, "%-20s %s\n", "transport", info.transport)
+	for _, s := range info.settings {
+		fmt.Fprintf(w, "%-20s %s\n", s.name, s.value)
+	}
+	if info.setting("synchronous_commit") == "on" {
+		fmt.Fprintln(w, "Note: synchronous_commit is on, so commit latency will dominate small-batch results")
+	}
+	fmt.Fprintln(w)
+}
+
+// displayCommitNote explains, after the results, why small batches are slow
+// on servers that wait for the WAL flush at every commit, and with
+// -async-commit shows how much of each result that wait accounts for.
+func displayCommitNote(w io.Writer, servers []serverInfo, results []Result) {
+	syncCommit := false
+	for _, s := range servers {
+		if s.setting("synchronous_commit") == "on" {
+			syncCommit = true
+		}
+	}
+	var async []Result
+	for _, r := range results {
+		if r.asyncCommit {
+			async = append(async, r)
+		}
+	}
+	if !syncCommit && len(async) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	if syncCommit {
+		fmt.Fprintln(w, "Note: synchronous_commit is on, so every commit waits for its WAL to be flushed to disk.")
+		fmt.Fprintln(w, "The smallest batches are bound by that fsync latency rather than by inserting rows;")
+		fmt.Fprintln(w, "larger batches amortize the wait over more rows, which is most of why they are faster.")
+		if len(async) == 0 {
+			fmt.Fprintln(w, "Run with -async-commit to measure how much of each result the wait accounts for.")
+		}
+	}
+	if len(async) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "Effect of synchronous_commit=off:")
+	for _, a := range async {
+		p := a.params()
+		p.async = false
+		s, ok := findResult(results, a.server, p)
+		if !ok || s.rowsPerSec == 0 {
+			continue
+		}
+		label := s.method + " " + resultLabel(s)
+		if s.server != "" {
+			label = s.server + " " + label
+		}
+		fmt.Fprintf(w, "  %-20s %12.0f -> %12.0f rows/sec (%.2fx)\n", label, s.rowsPerSec, a.rowsPerSec, a.rowsPerSec/s.rowsPerSec)
+	}
+}
+
+// logServer records the server version and settings in the diagnostic log.
+func logServer(info serverInfo) {
+	attrs := []any{"server_version", info.serverVersion, "transport", info.transport}
+	if info.name != "" {
+		attrs = append(attrs, "server", info.name)
+	}
+	for _, s := range info.settings {
+		attrs = append(attrs, s.name, s.value)
+	}
+	slog.Info("server settings", attrs...)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// serverTxTime returns how long the server has spent on tx so far: the
+// time since it received the BEGIN, by its own clock. Read just before
+// the commit, it covers every statement of the transaction and the round
+// trips between them, but not the round trips that begin and end it.
+func serverTxTime(ctx context.Context, tx pgx.Tx) (time.Duration, error) {
+	var seconds float64
+	err := tx.QueryRow(ctx, "SELECT extract(epoch FROM clock_timestamp() - transaction_timestamp())::float8").Scan(&seconds)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// txTiming compares the transactions' time measured by the client with the
+// server's own, see -server-timing.
+type txTiming struct {
+	txs    int
+	client time.Duration // Sum of the transactions' latencies
+	server time.Duration // Sum of their serverTxTime
+}
+
+// add counts the transactions of stats.
+func (t *txTiming) add(stats insertStats) {
+	t.txs += len(stats.latencies)
+	for _, l := range stats.latencies {
+		t.client += l
+	}
+	t.server += stats.serverTime
+}
+
+// overheadPerTx returns the mean time per transaction spent outside the
+// server's part of it: on the network and in the client.
+func (t txTiming) overheadPerTx() time.Duration {
+	if t.txs == 0 {
+		return 0
+	}
+	return max(t.client-t.server, 0) / time.Duration(t.txs)
+}
+
+// serverShare returns the server's part of the transactions' time.
+func (t txTiming) serverShare() float64 {
+	if t.client == 0 {
+		return 0
+	}
+	return float64(t.server) / float64(t.client)
+}
+
+type jsonTxTiming struct {
+	Transactions int   `json:"transactions"`
+	ClientNs     int64 `json:"client_ns"`
+	ServerNs     int64 `json:"server_ns"`
+	OverheadTxNs int64 `json:"overhead_per_tx_ns"`
+}
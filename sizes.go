@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tableSize is the disk space used by the benchmark table, split into the
+// main heap and its indexes. TOAST and the free space and visibility maps
+// make up the rest of total.
+type tableSize struct {
+	heap    int64
+	indexes int64
+	total   int64
+	rows    int // Rows in the table when it was measured
+}
+
+// heapPerRow and indexesPerRow return the bytes used per row, or 0 for an
+// empty table.
+func (s tableSize) heapPerRow() float64 {
+	if s.rows == 0 {
+		return 0
+	}
+	return float64(s.heap) / float64(s.rows)
+}
+
+func (s tableSize) indexesPerRow() float64 {
+	if s.rows == 0 {
+		return 0
+	}
+	return float64(s.indexes) / float64(s.rows)
+}
+
+// measureTableSize reads the size of table from the catalog, summed over
+// its partitions when it has them. rows is the number of rows the caller
+// knows the table to hold, which saves counting them.
+func measureTableSize(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, rows int) (tableSize, error) {
+	s := tableSize{rows: rows}
+	err := pool.QueryRow(ctx, `
+		SELECT sum(pg_relation_size(relid))::bigint, sum(pg_indexes_size(relid))::bigint, sum(pg_total_relation_size(relid))::bigint
+		FROM pg_partition_tree($1::regclass)`,
+		table.Sanitize()).Scan(&s.heap, &s.indexes, &s.total)
+	if err != nil {
+		return tableSize{}, fmt.Errorf("failed to read table size: %w", err)
+	}
+	return s, nil
+}
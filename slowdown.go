@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// displaySavepointOverhead prints, for each result measured with
+// -savepoint-every, how much throughput the savepoints cost compared with
+// the same run without them.
+func displaySavepointOverhead(w io.Writer, results []Result) {
+	isVariant := func(r Result) bool { return r.savepoint > 0 }
+	heading := func(r Result) string {
+		return fmt.Sprintf("Savepoint overhead (a savepoint every %d rows):", r.savepoint)
+	}
+	displaySlowdown(w, results, isVariant, heading, func(p *runParams) { p.savepoint = 0 })
+}
+
+// displayReturningOverhead prints, for each result measured with
+// -returning, how much throughput reading back the ids cost compared with
+// the same inserts without RETURNING.
+func displayReturningOverhead(w io.Writer, results []Result) {
+	isVariant := func(r Result) bool { return r.returning }
+	heading := func(Result) string { return "RETURNING id overhead:" }
+	displaySlowdown(w, results, isVariant, heading, func(p *runParams) { p.returning = false })
+}
+
+// displaySlowdown prints, under a heading for the first of them, each of
+// results that isVariant selects next to the result it is measured
+// against, found by applying plain to its parameters, with the change in
+// throughput as a percentage.
+func displaySlowdown(w io.Writer, results []Result, isVariant func(Result) bool, heading func(Result) string, plain func(*runParams)) {
+	header := false
+	for _, v := range results {
+		if !isVariant(v) {
+			continue
+		}
+		p := v.params()
+		plain(&p)
+		base, ok := findResult(results, v.server, p)
+		if !ok || base.rowsPerSec == 0 {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, heading(v))
+			header = true
+		}
+		label := v.method + " " + resultLabel(base)
+		if v.server != "" {
+			label = v.server + " " + label
+		}
+		change := (v.rowsPerSec/base.rowsPerSec - 1) * 100
+		fmt.Fprintf(w, "  %-20s %12.0f -> %12.0f rows/sec (%+.1f%%)\n", label, base.rowsPerSec, v.rowsPerSec, change)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// latencyPercentiles summarizes the distribution of transaction latencies.
+type latencyPercentiles struct {
+	p50 time.Duration
+	p90 time.Duration
+	p95 time.Duration
+	p99 time.Duration
+}
+
+func calculateMean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// calculateGeoMean returns the geometric mean of values, computed from the
+// mean of their logarithms so that large products don't overflow. Values
+// that aren't positive are skipped, since their logarithm is undefined.
+func calculateGeoMean(values []float64) float64 {
+	sum, n := 0.0, 0
+	for _, v := range values {
+		if v > 0 {
+			sum += math.Log(v)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return math.Exp(sum / float64(n))
+}
+
+// calculateMedian returns the middle value of values, or the mean of the two
+// middle values when there is an even number of them.
+func calculateMedian(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// calculateStdDev returns the sample standard deviation of values, using
+// Bessel's correction (n-1) since the samples are an estimate of the
+// underlying distribution. A single value has no spread and yields 0.
+func calculateStdDev(values []float64, mean float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	sumSquares := 0.0
+	for _, v := range values {
+		diff := v - mean
+		sumSquares += diff * diff
+	}
+	variance := sumSquares / float64(len(values)-1)
+	return math.Sqrt(variance)
+}
+
+// runningStats maintains the mean and sample standard deviation of a
+// stream of values in constant time per value, using Welford's algorithm,
+// which also avoids the cancellation of summing squares.
+type runningStats struct {
+	n    int
+	mean float64
+	m2   float64 // Sum of squared differences from the mean
+}
+
+func (s *runningStats) add(v float64) {
+	s.n++
+	delta := v - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (v - s.mean)
+}
+
+// stdDev returns the sample standard deviation like calculateStdDev.
+func (s *runningStats) stdDev() float64 {
+	if s.n < 2 {
+		return 0
+	}
+	return math.Sqrt(s.m2 / float64(s.n-1))
+}
+
+// percentile returns the p-th percentile (0-100) of sorted using linear
+// interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// tTable95 holds the two-sided 95% quantiles of Student's t-distribution
+// for 1 to 30 degrees of freedom.
+var tTable95 = [...]float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tQuantile95 returns the t-value for a 95% confidence interval with df
+// degrees of freedom. Beyond the table it steps down through the usual
+// coarser values, rounding df down so the interval errs on the wide side.
+func tQuantile95(df int) float64 {
+	switch {
+	case df < 1:
+		return math.Inf(1)
+	case df <= len(tTable95):
+		return tTable95[df-1]
+	case df < 60:
+		return 2.021 // df = 40
+	case df < 120:
+		return 2.000 // df = 60
+	case df < 1000:
+		return 1.980 // df = 120
+	default:
+		return 1.960
+	}
+}
+
+// calculateCI95 returns the half-width of the 95% confidence interval for
+// the mean of n samples with the given standard deviation, or 0 when there
+// are too few samples to estimate it.
+func calculateCI95(stdDev float64, n int) float64 {
+	if n < 2 {
+		return 0
+	}
+	return tQuantile95(n-1) * stdDev / math.Sqrt(float64(n))
+}
+
+// bootstrapCI95 returns the bounds of the percentile bootstrap 95%
+// confidence interval for the mean of values: the 2.5th and 97.5th
+// percentiles of the means of that many resamples of values, drawn with
+// replacement from an RNG seeded with seed. Unlike calculateCI95 it
+// doesn't assume the values are normally distributed. Both bounds are 0
+// when there are too few values to resample.
+func bootstrapCI95(values []float64, resamples int, seed uint64) (lo, hi float64) {
+	if len(values) < 2 || resamples == 0 {
+		return 0, 0
+	}
+	rng := rand.New(rand.NewPCG(seed, uint64(len(values))))
+	means := make([]float64, resamples)
+	for i := range means {
+		sum := 0.0
+		for range values {
+			sum += values[rng.IntN(len(values))]
+		}
+		means[i] = sum / float64(len(values))
+	}
+	slices.Sort(means)
+	return percentile(means, 2.5), percentile(means, 97.5)
+}
+
+// minRetainedSamples is the fewest samples rejectOutliers will leave.
+const minRetainedSamples = 3
+
+// rejectOutliers returns the values that lie within 1.5 interquartile
+// ranges of the first and third quartiles, in their original order. If that
+// would leave fewer than minRetainedSamples values, all values are kept.
+func rejectOutliers(values []float64) []float64 {
+	sorted := slices.Sorted(slices.Values(values))
+	q1 := percentile(sorted, 25)
+	q3 := percentile(sorted, 75)
+	lo := q1 - 1.5*(q3-q1)
+	hi := q3 + 1.5*(q3-q1)
+
+	kept := make([]float64, 0, len(values))
+	for _, v := range values {
+		if v >= lo && v <= hi {
+			kept = append(kept, v)
+		}
+	}
+	if len(kept) < minRetainedSamples {
+		return values
+	}
+	return kept
+}
+
+func calculateLatencyPercentiles(latencies []time.Duration) latencyPercentiles {
+	sorted := make([]float64, len(latencies))
+	for i, l := range latencies {
+		sorted[i] = float64(l)
+	}
+	slices.Sort(sorted)
+
+	return latencyPercentiles{
+		p50: time.Duration(percentile(sorted, 50)),
+		p90: time.Duration(percentile(sorted, 90)),
+		p95: time.Duration(percentile(sorted, 95)),
+		p99: time.Duration(percentile(sorted, 99)),
+	}
+}
+
+// latencyBucket counts the latencies falling at or below upperMicros and
+// above the previous bucket's bound.
+type latencyBucket struct {
+	upperMicros int64
+	count       int
+}
+
+// latencyBucketBounds are log-linear bucket upper bounds in microseconds,
+// following a 1-2-5 progression from 1µs to 500s.
+var latencyBucketBounds = func() []int64 {
+	var bounds []int64
+	for decade := int64(1); decade <= 100_000_000; decade *= 10 {
+		bounds = append(bounds, decade, 2*decade, 5*decade)
+	}
+	return bounds
+}()
+
+// bucketLatencies distributes latencies over latencyBucketBounds and trims
+// the empty buckets at either end. Latencies beyond the last bound are
+// counted in the last bucket.
+func bucketLatencies(latencies []time.Duration) []latencyBucket {
+	if len(latencies) == 0 {
+		return nil
+	}
+
+	counts := make([]int, len(latencyBucketBounds))
+	for _, l := range latencies {
+		us := l.Microseconds()
+		i, _ := slices.BinarySearch(latencyBucketBounds, us)
+		counts[min(i, len(counts)-1)]++
+	}
+
+	first := slices.IndexFunc(counts, func(c int) bool { return c > 0 })
+	last := len(counts) - 1
+	for counts[last] == 0 {
+		last--
+	}
+
+	buckets := make([]latencyBucket, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		buckets = append(buckets, latencyBucket{upperMicros: latencyBucketBounds[i], count: counts[i]})
+	}
+	return buckets
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestCalculateStdDev(t *testing.T) {
+	// The classic example: the mean is 5 and the squared differences from it
+	// sum to 32, so the population variance is 32/8 = 4 and the sample
+	// variance 32/7
+	values := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	const population, sample = 2.0, 2.138089935299395
+
+	got := calculateStdDev(values, 5)
+	if math.Abs(got-sample) > 1e-12 {
+		t.Errorf("calculateStdDev = %v, want the sample standard deviation %v", got, sample)
+	}
+	if math.Abs(got-population) < 1e-12 {
+		t.Errorf("calculateStdDev = %v, the population standard deviation", got)
+	}
+
+	var s runningStats
+	for _, v := range values {
+		s.add(v)
+	}
+	if math.Abs(s.stdDev()-sample) > 1e-12 {
+		t.Errorf("runningStats.stdDev = %v, want %v", s.stdDev(), sample)
+	}
+}
+
+func TestCalculateStdDevTooFewValues(t *testing.T) {
+	for _, values := range [][]float64{nil, {42}} {
+		if got := calculateStdDev(values, 42); got != 0 {
+			t.Errorf("calculateStdDev(%v) = %v, want 0", values, got)
+		}
+	}
+}
+
+func TestTQuantile95(t *testing.T) {
+	tests := []struct {
+		df   int
+		want float64
+	}{
+		{1, 12.706},
+		{4, 2.776},
+		{30, 2.042},
+		{45, 2.021},  // Rounded down to df = 40
+		{200, 1.980}, // Rounded down to df = 120
+		{5000, 1.960},
+	}
+	for _, tt := range tests {
+		if got := tQuantile95(tt.df); got != tt.want {
+			t.Errorf("tQuantile95(%d) = %v, want %v", tt.df, got, tt.want)
+		}
+	}
+	if got := tQuantile95(0); !math.IsInf(got, 1) {
+		t.Errorf("tQuantile95(0) = %v, want +Inf", got)
+	}
+}
+
+func TestCalculateCI95(t *testing.T) {
+	// Five samples with a standard deviation of 1: t(0.975, 4) / sqrt(5)
+	if got, want := calculateCI95(1, 5), 2.776/math.Sqrt(5); math.Abs(got-want) > 1e-12 {
+		t.Errorf("calculateCI95(1, 5) = %v, want %v", got, want)
+	}
+	if got := calculateCI95(1, 1); got != 0 {
+		t.Errorf("calculateCI95 of a single sample = %v, want 0", got)
+	}
+}
+
+func TestRejectOutliers(t *testing.T) {
+	tests := []struct {
+		values, want []float64
+	}{
+		// The quartiles are 11 and 13, so values outside [8, 16] are dropped
+		{[]float64{12, 100, 10, 13, 11}, []float64{12, 10, 13, 11}},
+		{[]float64{12, 10, 13, 11, 14}, []float64{12, 10, 13, 11, 14}},
+		// Without spread, anything different is an outlier
+		{[]float64{5, 5, 9, 5, 5}, []float64{5, 5, 5, 5}},
+		// Too few values to tell
+		{[]float64{1, 100}, []float64{1, 100}},
+	}
+	for _, tt := range tests {
+		if got := rejectOutliers(tt.values); !slices.Equal(got, tt.want) {
+			t.Errorf("rejectOutliers(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestBootstrapCI95(t *testing.T) {
+	// Every resample of constant samples has the same mean
+	if lo, hi := bootstrapCI95([]float64{7, 7, 7, 7, 7}, 1000, 1); lo != 7 || hi != 7 {
+		t.Errorf("bootstrapCI95 of constant samples = [%v, %v], want [7, 7]", lo, hi)
+	}
+
+	values := []float64{90, 95, 100, 105, 110}
+	lo, hi := bootstrapCI95(values, 1000, 42)
+	if !(lo < 100 && 100 < hi) || lo < 90 || hi > 110 {
+		t.Errorf("bootstrapCI95(%v) = [%v, %v], want an interval around 100 within the samples", values, lo, hi)
+	}
+	if lo2, hi2 := bootstrapCI95(values, 1000, 42); lo2 != lo || hi2 != hi {
+		t.Errorf("bootstrapCI95 gave [%v, %v] and [%v, %v] with the same seed", lo, hi, lo2, hi2)
+	}
+
+	if lo, hi := bootstrapCI95([]float64{100}, 1000, 42); lo != 0 || hi != 0 {
+		t.Errorf("bootstrapCI95 of a single sample = [%v, %v], want [0, 0]", lo, hi)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+)
+
+// stream writes an event per sample and per result as they complete, or is
+// nil when -stream is not set. Its methods are safe to call on a nil
+// receiver.
+var stream *sampleStream
+
+// sampleStream writes newline-delimited JSON events, so that a consumer
+// can follow a run as it converges.
+type sampleStream struct {
+	enc *json.Encoder
+}
+
+func newSampleStream(w io.Writer) *sampleStream {
+	return &sampleStream{enc: json.NewEncoder(w)}
+}
+
+// sampleEvent is the event written after each sample of a steady-state
+// benchmark. Mean and CV are over the samples so far.
+type sampleEvent struct {
+	Type       string  `json:"type"`
+	Op         string  `json:"op"`
+	Method     string  `json:"method"`
+	BatchSize  int     `json:"batch_size"`
+	Workers    int     `json:"workers"`
+	Sample     int     `json:"sample"`
+	RowsPerSec float64 `json:"rows_per_sec"`
+	Mean       float64 `json:"mean"`
+	CV         float64 `json:"cv"`
+}
+
+// summaryEvent is the event written once a benchmark's result is known.
+type summaryEvent struct {
+	Type string `json:"type"`
+	jsonResult
+}
+
+// sample writes the event for sample n of the benchmark of cfg.
+func (s *sampleStream) sample(cfg config, batchSize, n int, rowsPerSec float64, running runningStats) {
+	if s == nil {
+		return
+	}
+	cv := 0.0
+	if running.mean > 0 {
+		cv = running.stdDev() / running.mean
+	}
+	s.write(sampleEvent{
+		Type:       "sample",
+		Op:         cfg.op,
+		Method:     cfg.method,
+		BatchSize:  batchSize,
+		Workers:    cfg.workers,
+		Sample:     n,
+		RowsPerSec: rowsPerSec,
+		Mean:       running.mean,
+		CV:         cv,
+	})
+}
+
+// summary writes the event for a benchmark's result.
+func (s *sampleStream) summary(r Result) {
+	if s == nil {
+		return
+	}
+	s.write(summaryEvent{Type: "summary", jsonResult: toJSONResult(r)})
+}
+
+// write encodes event, logging rather than failing the run when the
+// consumer has gone away.
+func (s *sampleStream) write(event any) {
+	if err := s.enc.Encode(event); err != nil {
+		slog.Warn("failed to write to -stream", "err", err)
+	}
+}
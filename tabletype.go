@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Values of -table-type.
+const (
+	tableLogged   = "logged"
+	tableUnlogged = "unlogged"
+	tableTemp     = "temp"
+)
+
+// applyTableType readies table for the requested -table-type. Logged and
+// unlogged tables are converted only when they differ, since the conversion
+// rewrites the whole table. A temporary table is created as a copy of
+// table's definition that shadows it for the rest of the session, which is
+// why the pool is limited to a single connection in that case.
+func applyTableType(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, tableType string) error {
+	if tableType == tableTemp {
+		_, err := pool.Exec(ctx, "CREATE TEMP TABLE "+table.Sanitize()+" (LIKE "+table.Sanitize()+" INCLUDING ALL)")
+		return err
+	}
+
+	var persistence string
+	err := pool.QueryRow(ctx, "SELECT relpersistence::text FROM pg_class WHERE oid = $1::regclass", table.Sanitize()).Scan(&persistence)
+	if err != nil {
+		return err
+	}
+	switch {
+	case tableType == tableUnlogged && persistence != "u":
+		_, err = pool.Exec(ctx, "ALTER TABLE "+table.Sanitize()+" SET UNLOGGED")
+	case tableType == tableLogged && persistence != "p":
+		_, err = pool.Exec(ctx, "ALTER TABLE "+table.Sanitize()+" SET LOGGED")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to make table %s: %w", tableType, err)
+	}
+	return nil
+}
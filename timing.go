@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// phaseTimes accumulates the wall-clock time the run spends in each of its
+// phases. Benchmarks run one at a time, so the phases never overlap.
+type phaseTimes struct {
+	measuring time.Duration // Inserting the rows of the samples
+	warmup    time.Duration
+	prepare   time.Duration // Truncating, seeding and otherwise preparing the samples
+	cooldown  time.Duration
+}
+
+// phases accumulates the time spent in each phase since the program
+// started.
+var phases phaseTimes
+
+// addSince adds the time since start to d, as in
+// defer addSince(&phases.warmup, time.Now()).
+func addSince(d *time.Duration, start time.Time) {
+	*d += time.Since(start)
+}
+
+// overhead returns the time spent in the phases around the measurements.
+func (p phaseTimes) overhead() time.Duration {
+	return p.warmup + p.prepare + p.cooldown
+}
+
+// displayTiming prints how the run's wall-clock time divides between
+// measuring, the overhead around it and whatever else the run did, such as
+// connecting, migrating and building indexes.
+func displayTiming(w io.Writer, elapsed time.Duration, p phaseTimes) {
+	if elapsed == 0 {
+		return
+	}
+	share := func(d time.Duration) float64 { return float64(d) / float64(elapsed) * 100 }
+	other := max(elapsed-p.measuring-p.overhead(), 0)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Wall-clock time: %v\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "  %-10s %10v (%4.1f%%)\n", "measuring", p.measuring.Round(time.Millisecond), share(p.measuring))
+	fmt.Fprintf(w, "  %-10s %10v (%4.1f%%): warmup %v, prepare %v, cooldown %v\n", "overhead",
+		p.overhead().Round(time.Millisecond), share(p.overhead()), p.warmup.Round(time.Millisecond),
+		p.prepare.Round(time.Millisecond), p.cooldown.Round(time.Millisecond))
+	fmt.Fprintf(w, "  %-10s %10v (%4.1f%%)\n", "other", other.Round(time.Millisecond), share(other))
+}
+
+// jsonTiming is the serialized form of the run's wall-clock accounting.
+type jsonTiming struct {
+	TotalNs     int64 `json:"total_ns"`
+	MeasuringNs int64 `json:"measuring_ns"`
+	OverheadNs  int64 `json:"overhead_ns"`
+	WarmupNs    int64 `json:"warmup_ns"`
+	PrepareNs   int64 `json:"prepare_ns"`
+	CooldownNs  int64 `json:"cooldown_ns"`
+}
+
+func toJSONTiming(elapsed time.Duration, p phaseTimes) *jsonTiming {
+	if elapsed == 0 {
+		return nil
+	}
+	return &jsonTiming{
+		TotalNs:     elapsed.Nanoseconds(),
+		MeasuringNs: p.measuring.Nanoseconds(),
+		OverheadNs:  p.overhead().Nanoseconds(),
+		WarmupNs:    p.warmup.Nanoseconds(),
+		PrepareNs:   p.prepare.Nanoseconds(),
+		CooldownNs:  p.cooldown.Nanoseconds(),
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Values of -trigger.
+const (
+	triggerNone      = "none"
+	triggerNoop      = "noop"
+	triggerTimestamp = "timestamp"
+)
+
+// triggerFunctions maps each of -trigger's values to the PL/pgSQL function
+// the migrations create for it.
+var triggerFunctions = map[string]string{
+	triggerNoop:      "pscale_noop_trigger",
+	triggerTimestamp: "pscale_timestamp_trigger",
+}
+
+// setTrigger drops the BEFORE INSERT trigger on table added by an earlier
+// call, and then adds the one for kind, unless it is triggerNone.
+func setTrigger(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier, kind string) error {
+	name := pgx.Identifier{table[len(table)-1] + "_pscale_trigger"}.Sanitize()
+	if _, err := pool.Exec(ctx, "DROP TRIGGER IF EXISTS "+name+" ON "+table.Sanitize()); err != nil {
+		return fmt.Errorf("failed to drop trigger: %w", err)
+	}
+	if kind == triggerNone {
+		return nil
+	}
+	sql := "CREATE TRIGGER " + name + " BEFORE INSERT ON " + table.Sanitize() +
+		" FOR EACH ROW EXECUTE FUNCTION " + triggerFunctions[kind] + "()"
+	if _, err := pool.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to create trigger: %w", err)
+	}
+	return nil
+}
+
+// displayTriggerOverhead prints, for each result measured with -trigger,
+// how much throughput the trigger cost compared with the same run without
+// it.
+func displayTriggerOverhead(w io.Writer, results []Result) {
+	isVariant := func(r Result) bool { return r.trigger != triggerNone }
+	heading := func(r Result) string {
+		return fmt.Sprintf("Trigger overhead (a %s BEFORE INSERT trigger on every row):", r.trigger)
+	}
+	displaySlowdown(w, results, isVariant, heading, func(p *runParams) { p.trigger = triggerNone })
+}
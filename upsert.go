@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// upsertRows is the rowSource of an upsert sample. Rows are numbered from
+// base, which becomes their id when the key is serial, and the rows picked
+// by conflict duplicate a row loaded into the table before the sample.
+type upsertRows struct {
+	src  rowSource
+	base int64
+	rate float64
+	keys [][16]byte // Keys of the duplicates, when the key is a UUID
+}
+
+func (u upsertRows) Len() int { return u.src.Len() }
+
+func (u upsertRows) Stream(offset, n int) rowStream {
+	return &upsertStream{rowStream: u.src.Stream(offset, n), rows: u, next: offset}
+}
+
+// conflict reports whether row i duplicates an existing row, spreading the
+// duplicates evenly over the sample, and how many duplicates precede it.
+func (u upsertRows) conflict(i int) (int, bool) {
+	before := int(float64(i) * u.rate)
+	return before, int(float64(i+1)*u.rate) > before
+}
+
+type upsertStream struct {
+	rows upsertRows
+	rowStream
+	next int
+}
+
+func (s *upsertStream) Next() (TestRow, bool) {
+	row, ok := s.rowStream.Next()
+	if !ok {
+		return TestRow{}, false
+	}
+	i := s.next
+	s.next++
+	row.id = s.rows.base + int64(i) + 1
+	if k, dup := s.rows.conflict(i); dup && row.key.Valid {
+		row.key.Bytes = s.rows.keys[k]
+	}
+	return row, true
+}
+
+// prepareUpsert extends the setup of an insert sample of n rows for
+// upserting: it numbers the rows and loads the ones that will conflict.
+// Serial keys are numbered from the highest id in the table, which may
+// have been taken from the sequence by -seed-rows.
+func prepareUpsert(ctx context.Context, pool *pgxpool.Pool, setup sampleSetup, cfg config, opts insertOptions, n int) (sampleSetup, error) {
+	rows := upsertRows{src: setup.src, rate: cfg.conflictRate}
+	if cfg.pk == pkSerial {
+		if err := pool.QueryRow(ctx, "SELECT coalesce(max(id), 0) FROM "+opts.table.Sanitize()).Scan(&rows.base); err != nil {
+			return sampleSetup{}, err
+		}
+	}
+	if newKey, ok := keyGenerators[cfg.pk]; ok {
+		rows.keys = make([][16]byte, int(float64(n)*cfg.conflictRate))
+		for i := range rows.keys {
+			rows.keys[i] = newKey()
+		}
+	}
+
+	loaded, err := loadConflicts(ctx, pool, rows, opts, n)
+	if err != nil {
+		return sampleSetup{}, fmt.Errorf("failed to load conflicting rows: %w", err)
+	}
+	setup.src = rows
+	setup.rowsBefore += loaded
+	setup.conflicts = loaded
+	return setup, nil
+}
+
+// loadConflicts copies the rows among the first n of rows that the sample
+// will duplicate into the table, and returns how many it loaded.
+func loadConflicts(ctx context.Context, pool *pgxpool.Pool, rows upsertRows, opts insertOptions, n int) (int, error) {
+	if rows.rate == 0 {
+		return 0, nil
+	}
+	columns, values := upsertColumns(opts.columns)
+	stream := rows.Stream(0, n)
+	defer stream.Close()
+	i := 0
+	loaded, err := pool.CopyFrom(ctx, opts.table, columns, pgx.CopyFromFunc(func() ([]any, error) {
+		for row, ok := stream.Next(); ok; row, ok = stream.Next() {
+			_, dup := rows.conflict(i)
+			i++
+			if dup {
+				return values(row), nil
+			}
+		}
+		return nil, stream.Err()
+	}))
+	return int(loaded), err
+}
+
+// upsertColumns returns the columns an upsert writes and a function giving
+// their values for a row. A serial id is written explicitly, since rows
+// can only conflict on a key they carry.
+func upsertColumns(columns []string) ([]string, func(TestRow) []any) {
+	if slices.Contains(columns, "id") {
+		return columns, func(row TestRow) []any { return row.values(nil) }
+	}
+	return append([]string{"id"}, columns...), func(row TestRow) []any {
+		return row.values([]any{row.id})
+	}
+}
+
+// insertWithUpsert inserts like insertWithBatch, but skips rows whose key
+// already exists with ON CONFLICT (id) DO NOTHING.
+func insertWithUpsert(ctx context.Context, pool *pgxpool.Pool, rows rowStream, opts insertOptions) (insertStats, error) {
+	columns, values := upsertColumns(opts.columns)
+	sql := insertSQL(opts.table, columns) + " ON CONFLICT (id) DO NOTHING"
+
+	return runTransactions(ctx, pool, rows, opts, func(ctx context.Context, tx pgx.Tx, rows []TestRow) error {
+		batch := &pgx.Batch{}
+		for _, row := range rows {
+			batch.Queue(sql, values(row)...)
+		}
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+// checkUniqueKey verifies that table has a unique index on id alone, which
+// ON CONFLICT (id) needs to infer its arbiter. The migrations create one as
+// the primary key; a table managed elsewhere may lack it.
+func checkUniqueKey(ctx context.Context, pool *pgxpool.Pool, table pgx.Identifier) error {
+	var ok bool
+	err := pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_index i
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+			WHERE i.indrelid = $1::regclass AND i.indisunique AND i.indnkeyatts = 1 AND a.attname = 'id'
+		)`, table.Sanitize()).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s has no unique index on id", table.Sanitize())
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// currentWALLSN returns the server's current WAL write position, to be
+// passed to walSince once the work to be measured is done.
+func currentWALLSN(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	var lsn string
+	if err := pool.QueryRow(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&lsn); err != nil {
+		return "", fmt.Errorf("failed to read WAL position: %w", err)
+	}
+	return lsn, nil
+}
+
+// walSince returns the bytes of WAL written since lsn. The count covers
+// everything the server did in between, not only the benchmark, so other
+// traffic on the server inflates it.
+func walSince(ctx context.Context, pool *pgxpool.Pool, lsn string) (int64, error) {
+	var n int64
+	if err := pool.QueryRow(ctx, "SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), $1::pg_lsn)::bigint", lsn).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to measure WAL volume: %w", err)
+	}
+	return n, nil
+}